@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/thrashdev/bootdev-peril/internal/pubsub"
+	"github.com/thrashdev/bootdev-peril/internal/routing"
+)
+
+const dlqBrowseLimit = 100
+
+func commandDLQ(broker pubsub.Broker, words []string) {
+	if len(words) == 0 {
+		fmt.Println("usage: dlq <list|show|replay|purge>")
+		return
+	}
+	switch words[0] {
+	case "list":
+		dlqList(broker)
+	case "show":
+		if len(words) < 2 {
+			fmt.Println("usage: dlq show <n>")
+			return
+		}
+		n, err := strconv.Atoi(words[1])
+		if err != nil {
+			fmt.Printf("error: %s is not a valid message number\n", words[1])
+			return
+		}
+		dlqShow(broker, n)
+	case "replay":
+		if len(words) < 2 {
+			fmt.Println("usage: dlq replay <n|all>")
+			return
+		}
+		n := 0
+		if words[1] != "all" {
+			var err error
+			n, err = strconv.Atoi(words[1])
+			if err != nil {
+				fmt.Printf("error: %s is not a valid message number\n", words[1])
+				return
+			}
+		}
+		dlqReplay(broker, n)
+	case "purge":
+		n, err := broker.Purge(routing.DeadLetterQueue)
+		if err != nil {
+			fmt.Printf("error: %s\n", err)
+			return
+		}
+		fmt.Printf("Purged %d message(s) from %s\n", n, routing.DeadLetterQueue)
+	default:
+		fmt.Println("usage: dlq <list|show|replay|purge>")
+	}
+}
+
+// fetchDLQ takes up to dlqBrowseLimit messages off the dead-letter queue. The
+// caller owns them and must ack or return each one.
+func fetchDLQ(broker pubsub.Broker) ([]pubsub.Message, error) {
+	msgs := []pubsub.Message{}
+	for len(msgs) < dlqBrowseLimit {
+		msg, ok, err := broker.Get(routing.DeadLetterQueue)
+		if err != nil {
+			returnDLQ(msgs)
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// returnDLQ puts messages back on the queue, last first so they keep their
+// order.
+func returnDLQ(msgs []pubsub.Message) {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		msgs[i].Nack(true)
+	}
+}
+
+func dlqList(broker pubsub.Broker) {
+	msgs, err := fetchDLQ(broker)
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		return
+	}
+	defer returnDLQ(msgs)
+
+	if len(msgs) == 0 {
+		fmt.Println("The dead-letter queue is empty.")
+		return
+	}
+	for i, msg := range msgs {
+		dl, _ := pubsub.DeadLetterInfo(msg)
+		fmt.Printf("%d: %s/%s (%s) from %s: %s\n", i+1, dl.Exchange, dl.RoutingKey, msg.ContentType, dl.Queue, dl.Reason)
+	}
+	if len(msgs) == dlqBrowseLimit {
+		fmt.Printf("Only the first %d messages are shown.\n", dlqBrowseLimit)
+	}
+}
+
+func dlqShow(broker pubsub.Broker, n int) {
+	msgs, err := fetchDLQ(broker)
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		return
+	}
+	defer returnDLQ(msgs)
+
+	if n < 1 || n > len(msgs) {
+		fmt.Printf("error: no message %d, the queue has %d\n", n, len(msgs))
+		return
+	}
+	msg := msgs[n-1]
+	dl, _ := pubsub.DeadLetterInfo(msg)
+	fmt.Printf("Exchange:     %s\n", dl.Exchange)
+	fmt.Printf("Routing key:  %s\n", dl.RoutingKey)
+	fmt.Printf("Queue:        %s\n", dl.Queue)
+	fmt.Printf("Reason:       %s\n", dl.Reason)
+	fmt.Printf("Deaths:       %d\n", dl.Count)
+	fmt.Printf("Content type: %s\n", msg.ContentType)
+	fmt.Printf("Message ID:   %s\n", msg.MessageID)
+	fmt.Printf("Type:         %s\n", msg.Type)
+	fmt.Printf("Sender:       %s\n", msg.Sender)
+	fmt.Printf("Published:    %s\n", msg.Timestamp.Format(time.RFC3339))
+	fmt.Println("Payload:")
+	fmt.Println(describePayload(msg, dl.Exchange, dl.RoutingKey))
+}
+
+// dlqReplay republishes message n, or all of them when n is 0, to the
+// exchange it was originally published to.
+func dlqReplay(broker pubsub.Broker, n int) {
+	msgs, err := fetchDLQ(broker)
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		return
+	}
+	if n < 0 || n > len(msgs) {
+		returnDLQ(msgs)
+		fmt.Printf("error: no message %d, the queue has %d\n", n, len(msgs))
+		return
+	}
+
+	keep := []pubsub.Message{}
+	replayed := 0
+	for i, msg := range msgs {
+		if n != 0 && i != n-1 {
+			keep = append(keep, msg)
+			continue
+		}
+		dl, ok := pubsub.DeadLetterInfo(msg)
+		if !ok || dl.Exchange == "" {
+			fmt.Printf("%d: no original exchange recorded, skipping\n", i+1)
+			keep = append(keep, msg)
+			continue
+		}
+		err := broker.Publish(context.Background(), dl.Exchange, dl.RoutingKey, pubsub.Revived(msg))
+		if err != nil {
+			fmt.Printf("%d: could not republish: %s\n", i+1, err)
+			keep = append(keep, msg)
+			continue
+		}
+		msg.Ack()
+		replayed++
+	}
+	returnDLQ(keep)
+	fmt.Printf("Replayed %d message(s)\n", replayed)
+}
+
+func describePayload(msg pubsub.Message, exchange, key string) string {
+	codec, ok := pubsub.LookupCodec(msg.ContentType)
+	if !ok {
+		return fmt.Sprintf("(%d bytes of %s)", len(msg.Body), msg.ContentType)
+	}
+	if topic, ok := routing.LookupTopic(exchange, key); ok {
+		target := topic.NewPayload()
+		if err := codec.Unmarshal(msg.Body, target); err == nil {
+			return fmt.Sprintf("%+v", target)
+		}
+	}
+	var buf bytes.Buffer
+	if json.Indent(&buf, msg.Body, "", "  ") == nil {
+		return buf.String()
+	}
+	return fmt.Sprintf("(%d bytes that could not be decoded)", len(msg.Body))
+}
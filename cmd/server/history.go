@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/thrashdev/bootdev-peril/internal/gamelogic"
+)
+
+const historyDefaultCount = 20
+
+func commandHistory(history *gamelogic.EventLog, words []string) {
+	count := historyDefaultCount
+	if len(words) > 0 {
+		n, err := strconv.Atoi(words[0])
+		if err != nil || n < 1 {
+			fmt.Printf("error: %s is not a valid count\n", words[0])
+			return
+		}
+		count = n
+	}
+	events := history.Events()
+	if len(events) == 0 {
+		fmt.Println("No events recorded")
+		return
+	}
+	start := max(len(events)-count, 0)
+	fmt.Printf("Showing events %d-%d of %d:\n", start+1, len(events), len(events))
+	for _, e := range events[start:] {
+		fmt.Println(e)
+	}
+}
+
+// commandReplay rebuilds a player's state from the history, on top of the
+// snapshot the game resumed from unless the history goes back to the start.
+func commandReplay(history *gamelogic.EventLog, snapshot gamelogic.Snapshot, words []string) {
+	if len(words) == 0 {
+		fmt.Println("usage: replay <username> [event]")
+		return
+	}
+	events := history.Events()
+	base, first, last := gamelogic.ReplayRange(snapshot, events)
+	if last == 0 {
+		fmt.Println("No events recorded")
+		return
+	}
+	upTo := last
+	if len(words) > 1 {
+		n, err := strconv.ParseUint(words[1], 10, 64)
+		if err != nil || n < first || n > last {
+			fmt.Printf("error: %s is not a recorded event, expected %d-%d\n", words[1], first, last)
+			return
+		}
+		upTo = n
+	}
+	gs, err := gamelogic.Replay(base, events, words[0], upTo)
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		return
+	}
+	fmt.Printf("After event %d of %d:\n", upTo, last)
+	report, _ := gs.HandleUnitsQuery(gamelogic.UnitsQuery{})
+	gamelogic.PrintUnitsReport(report)
+}
+
+func commandStandings(world *gamelogic.World) {
+	standings := world.Standings()
+	if len(standings) == 0 {
+		fmt.Println("Nobody has joined yet")
+		return
+	}
+	for i, s := range standings {
+		fmt.Printf("%d. %s: score %d, %d unit(s), %d territories\n", i+1, s.Username, s.Score, s.Units, len(s.Territories))
+		for _, r := range s.Regions {
+			fmt.Printf("    holds all of the %s\n", r)
+		}
+	}
+	owners := world.Owners()
+	locs := make([]gamelogic.Location, 0, len(owners))
+	for loc := range owners {
+		locs = append(locs, loc)
+	}
+	slices.Sort(locs)
+	for _, loc := range locs {
+		fmt.Printf("* %s: %s\n", loc, owners[loc])
+	}
+}
+
+func commandSnapshot(auth *authority, words []string) {
+	if len(words) == 0 {
+		fmt.Println("usage: snapshot <file>")
+		return
+	}
+	s := auth.snapshot()
+	if err := gamelogic.WriteSnapshot(words[0], s); err != nil {
+		fmt.Printf("error: %s\n", err)
+		return
+	}
+	fmt.Printf("Saved %d player(s) as of event %d to %s\n", len(s.Players), s.Seq, words[0])
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"time"
+
+	"github.com/thrashdev/bootdev-peril/internal/gamelogic"
+	"github.com/thrashdev/bootdev-peril/internal/pubsub"
+	"github.com/thrashdev/bootdev-peril/internal/routing"
+)
+
+// runTurns drives the turn clock until ctx is done or the game is over. A
+// turn ends when its time is up or every connected player is ready, but its
+// orders are only resolved while the game is not paused. Who is connected is
+// checked at the start of each turn through requester.
+func (a *authority) runTurns(ctx context.Context, requester pubsub.Requester) {
+	for !a.world.Over() {
+		a.startTurn()
+		go a.refreshOnline(ctx, requester)
+		timer := time.NewTimer(a.turnLength)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-a.allReady:
+			timer.Stop()
+		}
+		for a.isPaused() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-a.resumed:
+			}
+		}
+		a.endTurn()
+	}
+}
+
+func (a *authority) startTurn() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.turn = gamelogic.TurnState{Turn: a.world.Turn(), Deadline: time.Now().Add(a.turnLength)}
+	a.ready = map[string]bool{}
+	select {
+	case <-a.allReady:
+	default:
+	}
+	a.announceTurn()
+}
+
+func (a *authority) endTurn() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.turn.Ended = true
+	a.announceTurn()
+	events := a.world.EndTurn()
+	a.record(events...)
+	a.broadcast("", events)
+	a.checkVictory()
+}
+
+// announceTurn must be called with a.mu held.
+func (a *authority) announceTurn() {
+	err := routing.Turns.Publish(a.publisher, "", a.turn)
+	if err != nil {
+		slog.Error("could not announce turn", "turn", a.turn.Turn, "ended", a.turn.Ended, "error", err)
+	}
+}
+
+func (a *authority) handleReady(_ context.Context, d pubsub.Delivery[gamelogic.ReadyCommand]) (gamelogic.CommandResult, error) {
+	if err := a.checkSender(d.Envelope, d.Payload.Username); err != nil {
+		return gamelogic.CommandResult{}, err
+	}
+	if a.turnLength <= 0 {
+		return gamelogic.CommandResult{}, badRequest(errors.New("the game is not turn-based"))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ready[d.Payload.Username] = true
+	a.checkAllReady()
+	return gamelogic.CommandResult{Turn: a.turn.Turn}, nil
+}
+
+// checkAllReady ends the turn early once every connected player is ready. It
+// must be called with a.mu held.
+func (a *authority) checkAllReady() {
+	if len(a.ready) == 0 {
+		return
+	}
+	for username := range a.online {
+		if !a.ready[username] {
+			return
+		}
+	}
+	select {
+	case a.allReady <- struct{}{}:
+	default:
+	}
+}
+
+// refreshOnline replaces the players the turn waits on with the clients that
+// answer a status query, so players who left don't hold up every turn.
+func (a *authority) refreshOnline(ctx context.Context, requester pubsub.Requester) {
+	a.mu.Lock()
+	before := maps.Clone(a.online)
+	a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, statusWait)
+	defer cancel()
+	reports, err := routing.StatusQuery.CallAll(ctx, requester, "", gamelogic.StatusQuery{})
+	var unroutable *pubsub.UnroutableError
+	if err != nil && !errors.As(err, &unroutable) {
+		slog.Warn("could not check which players are connected", "error", err)
+		return
+	}
+	online := map[string]bool{}
+	for _, r := range reports {
+		online[r.Payload.Username] = true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// Players who joined while waiting may have missed the query.
+	for username := range a.online {
+		if !before[username] {
+			online[username] = true
+		}
+	}
+	a.online = online
+	a.checkAllReady()
+}
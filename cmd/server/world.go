@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/thrashdev/bootdev-peril/internal/gamelogic"
+	"github.com/thrashdev/bootdev-peril/internal/pubsub"
+	"github.com/thrashdev/bootdev-peril/internal/routing"
+)
+
+// authority applies player commands to the world, records the events they
+// produce and broadcasts them. mu is held throughout so events are recorded
+// and go out in Seq order.
+type authority struct {
+	mu        sync.Mutex
+	world     *gamelogic.World
+	history   *gamelogic.EventLog
+	publisher pubsub.Publisher
+	victory   gamelogic.Victory
+	// authenticate checks commands against the broker login rather than
+	// the sender the client claims.
+	authenticate bool
+
+	// turnLength is zero in real-time games. In turn-based games commands
+	// are queued and resolved when the turn ends.
+	turnLength time.Duration
+	turn       gamelogic.TurnState
+	online     map[string]bool
+	ready      map[string]bool
+	allReady   chan struct{}
+	resumed    chan struct{}
+}
+
+func newAuthority(world *gamelogic.World, history *gamelogic.EventLog, publisher pubsub.Publisher, victory gamelogic.Victory, turnLength time.Duration) *authority {
+	return &authority{
+		world:      world,
+		history:    history,
+		publisher:  publisher,
+		victory:    victory,
+		turnLength: turnLength,
+		online:     map[string]bool{},
+		ready:      map[string]bool{},
+		allReady:   make(chan struct{}, 1),
+		resumed:    make(chan struct{}, 1),
+	}
+}
+
+// serve answers the join, spawn, move, ready, resources and diplomacy
+// commands.
+func (a *authority) serve(ctx context.Context, broker pubsub.Broker) ([]*pubsub.Subscription, error) {
+	subs := []*pubsub.Subscription{}
+	sub, err := routing.Join.Serve(ctx, broker, "", a.handleJoin)
+	if err != nil {
+		return subs, fmt.Errorf("could not serve joins: %w", err)
+	}
+	subs = append(subs, sub)
+	sub, err = routing.Spawn.Serve(ctx, broker, "", func(_ context.Context, d pubsub.Delivery[gamelogic.SpawnCommand]) (gamelogic.CommandResult, error) {
+		if err := a.checkSender(d.Envelope, d.Payload.Username); err != nil {
+			return gamelogic.CommandResult{}, err
+		}
+		if a.turnLength > 0 {
+			return a.queue(func() (int, error) {
+				return a.world.QueueSpawn(d.Payload)
+			})
+		}
+		return a.apply(d.Envelope, func() ([]gamelogic.Event, error) {
+			return a.world.Spawn(d.Payload)
+		})
+	})
+	if err != nil {
+		return subs, fmt.Errorf("could not serve spawns: %w", err)
+	}
+	subs = append(subs, sub)
+	sub, err = routing.Move.Serve(ctx, broker, "", func(_ context.Context, d pubsub.Delivery[gamelogic.MoveCommand]) (gamelogic.CommandResult, error) {
+		if err := a.checkSender(d.Envelope, d.Payload.Username); err != nil {
+			return gamelogic.CommandResult{}, err
+		}
+		if a.turnLength > 0 {
+			return a.queue(func() (int, error) {
+				return a.world.QueueMove(d.Payload)
+			})
+		}
+		return a.apply(d.Envelope, func() ([]gamelogic.Event, error) {
+			return a.world.Move(d.Payload)
+		})
+	})
+	if err != nil {
+		return subs, fmt.Errorf("could not serve moves: %w", err)
+	}
+	subs = append(subs, sub)
+	sub, err = routing.Ready.Serve(ctx, broker, "", a.handleReady)
+	if err != nil {
+		return subs, fmt.Errorf("could not serve ready: %w", err)
+	}
+	subs = append(subs, sub)
+	sub, err = routing.Resources.Serve(ctx, broker, "", func(_ context.Context, d pubsub.Delivery[gamelogic.ResourcesQuery]) (gamelogic.ResourcesReport, error) {
+		if err := a.checkSender(d.Envelope, d.Payload.Username); err != nil {
+			return gamelogic.ResourcesReport{}, err
+		}
+		report, err := a.world.Resources(d.Payload)
+		if err != nil {
+			return report, badRequest(err)
+		}
+		return report, nil
+	})
+	if err != nil {
+		return subs, fmt.Errorf("could not serve resources: %w", err)
+	}
+	subs = append(subs, sub)
+	sub, err = routing.Diplomacy.Serve(ctx, broker, "", func(_ context.Context, d pubsub.Delivery[gamelogic.Diplomacy]) (gamelogic.CommandResult, error) {
+		if err := a.checkSender(d.Envelope, d.Payload.From); err != nil {
+			return gamelogic.CommandResult{}, err
+		}
+		return a.apply(d.Envelope, func() ([]gamelogic.Event, error) {
+			return a.world.Diplomacy(d.Payload)
+		})
+	})
+	if err != nil {
+		return subs, fmt.Errorf("could not serve diplomacy: %w", err)
+	}
+	return append(subs, sub), nil
+}
+
+func (a *authority) handleJoin(_ context.Context, d pubsub.Delivery[gamelogic.JoinCommand]) (gamelogic.JoinResult, error) {
+	if err := a.checkSender(d.Envelope, d.Payload.Username); err != nil {
+		return gamelogic.JoinResult{}, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	jr, err := a.world.Join(d.Payload.Username)
+	if err != nil {
+		return jr, badRequest(err)
+	}
+	a.online[d.Payload.Username] = true
+	if a.turnLength > 0 {
+		turn := a.turn
+		jr.Turn = &turn
+	}
+	return jr, nil
+}
+
+// apply runs a command, then records and broadcasts its events. Once the
+// world has changed the command has happened, so failures after that are
+// only logged.
+func (a *authority) apply(cmd pubsub.Envelope, fn func() ([]gamelogic.Event, error)) (gamelogic.CommandResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	events, err := fn()
+	if err != nil {
+		return gamelogic.CommandResult{}, badRequest(err)
+	}
+
+	a.record(events...)
+	a.broadcast(cmd.MessageID, events)
+	a.checkVictory()
+	return gamelogic.CommandResult{Seq: events[len(events)-1].Seq}, nil
+}
+
+// queue holds a command until the turn ends.
+func (a *authority) queue(fn func() (int, error)) (gamelogic.CommandResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	turn, err := fn()
+	if err != nil {
+		return gamelogic.CommandResult{}, badRequest(err)
+	}
+	return gamelogic.CommandResult{Turn: turn}, nil
+}
+
+// broadcast must be called with a.mu held. Events without a player, such
+// as pauses and turn ends, are announced on their own topics, and diplomacy
+// only goes to the two players involved.
+func (a *authority) broadcast(correlationID string, events []gamelogic.Event) {
+	for _, ev := range events {
+		if ev.Player == "" {
+			continue
+		}
+		if ev.Diplomacy != nil {
+			a.sendDiplomacy(correlationID, *ev.Diplomacy)
+			continue
+		}
+		if err := routing.WorldEvents.Publish(a.publisher, ev.Player, ev, pubsub.WithCorrelationID(correlationID)); err != nil {
+			slog.Error("could not broadcast event", "seq", ev.Seq, "kind", ev.Kind, "error", err)
+		}
+		if ev.War != nil {
+			a.logWar(correlationID, *ev.War)
+		}
+	}
+}
+
+func (a *authority) sendDiplomacy(correlationID string, d gamelogic.Diplomacy) {
+	for _, username := range []string{d.From, d.To} {
+		if err := routing.DiplomacyMessages.Publish(a.publisher, username, d, pubsub.WithCorrelationID(correlationID)); err != nil {
+			slog.Error("could not send diplomacy", "to", username, "error", err)
+		}
+	}
+}
+
+func (a *authority) logWar(correlationID string, war gamelogic.WarResult) {
+	msg := fmt.Sprintf("%s won a war against %s", war.Winner, war.Loser)
+	if war.Winner == "" {
+		msg = fmt.Sprintf("A war between %s and %s resulted in a draw", war.Attacker, war.Defender)
+	}
+	gl := routing.GameLog{CurrentTime: time.Now(), Message: msg, Username: war.Attacker}
+	if err := routing.GameLogs.Publish(a.publisher, war.Attacker, gl, pubsub.WithCorrelationID(correlationID)); err != nil {
+		slog.Error("could not publish war log", "error", err)
+	}
+}
+
+// runIncome pays income every interval until ctx is done. Turn-based games
+// are paid at the end of each turn instead.
+func (a *authority) runIncome(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.payIncome()
+		}
+	}
+}
+
+func (a *authority) payIncome() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.world.Paused() {
+		return
+	}
+	events := a.world.PayIncome()
+	if len(events) == 0 {
+		return
+	}
+	a.record(events...)
+	a.broadcast("", events)
+	a.checkVictory()
+}
+
+// runTimeLimit ends the game on score once limit has passed.
+func (a *authority) runTimeLimit(ctx context.Context, limit time.Duration) {
+	timer := time.NewTimer(limit)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if ev, ok := a.world.EndByScore(); ok {
+			a.finish(ev)
+		}
+	}
+}
+
+// checkVictory must be called with a.mu held.
+func (a *authority) checkVictory() {
+	if ev, ok := a.world.CheckVictory(a.victory); ok {
+		a.finish(ev)
+	}
+}
+
+// finish records and announces the end of the game. It must be called with
+// a.mu held.
+func (a *authority) finish(ev gamelogic.Event) {
+	over := *ev.GameOver
+	a.record(ev)
+	if err := routing.GameOver.Publish(a.publisher, "", over); err != nil {
+		slog.Error("could not announce game over", "error", err)
+	}
+
+	fmt.Println()
+	fmt.Println("==== Game Over ====")
+	gamelogic.PrintGameOver(over, "")
+	fmt.Print("> ")
+	slog.Info("game over", "winner", over.Winner, "reason", over.Reason)
+	msg := "Game over: nobody won"
+	if over.Winner != "" {
+		msg = fmt.Sprintf("Game over: %s won, they %s", over.Winner, over.Reason)
+	}
+	gl := routing.GameLog{CurrentTime: time.Now(), Message: msg, Username: "server"}
+	if err := routing.GameLogs.Publish(a.publisher, "server", gl); err != nil {
+		slog.Error("could not publish game over log", "error", err)
+	}
+}
+
+func (a *authority) setPaused(paused bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.record(a.world.SetPaused(paused))
+	if !paused {
+		select {
+		case a.resumed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (a *authority) isPaused() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.world.Paused()
+}
+
+func (a *authority) snapshot() gamelogic.Snapshot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.world.Snapshot()
+}
+
+// record must be called with a.mu held.
+func (a *authority) record(events ...gamelogic.Event) {
+	if err := a.history.Append(events...); err != nil {
+		slog.Error("could not record events", "first_seq", events[0].Seq, "count", len(events), "error", err)
+	}
+}
+
+// checkSender rejects commands made in another player's name. The sender
+// is whatever the client stamped, so on its own this only stops mistakes,
+// not cheats; with a.authenticate the player must be logged in to the
+// broker under their own username, which the broker vouches for.
+func (a *authority) checkSender(env pubsub.Envelope, username string) error {
+	sender := env.Sender
+	if a.authenticate {
+		sender = env.UserID
+	}
+	if sender != username {
+		return badRequest(fmt.Errorf("%q can not act as %q", sender, username))
+	}
+	return nil
+}
+
+func badRequest(err error) error {
+	return &pubsub.RemoteError{Code: pubsub.RPCErrorBadRequest, Message: err.Error()}
+}
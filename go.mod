@@ -2,4 +2,4 @@ module github.com/thrashdev/bootdev-peril
 
 go 1.22.1
 
-require github.com/rabbitmq/amqp091-go v1.10.0 // indirect
+require github.com/rabbitmq/amqp091-go v1.10.0
@@ -0,0 +1,132 @@
+package gamelogic
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Load replaces the local state with the server's.
+func (gs *GameState) Load(jr JoinResult) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Player.Units = map[int]Unit{}
+	for id, unit := range jr.Player.Units {
+		gs.Player.Units[id] = unit
+	}
+	gs.Paused = jr.Paused
+	gs.seq = jr.Seq
+	gs.resources = jr.Resources
+	if jr.Turn != nil {
+		gs.turn = *jr.Turn
+	}
+	gs.pacts = slices.Clone(jr.Pacts)
+	gs.proposals = slices.Clone(jr.Proposals)
+}
+
+// ApplyEvent applies an event from the server. Events already applied are
+// skipped and false is returned.
+func (gs *GameState) ApplyEvent(e Event) bool {
+	gs.mu.Lock()
+	if e.Seq <= gs.seq {
+		gs.mu.Unlock()
+		return false
+	}
+	gs.seq = e.Seq
+	gs.mu.Unlock()
+
+	switch e.Kind {
+	case EventSpawn:
+		gs.applySpawn(e)
+	case EventMove:
+		gs.applyMove(e)
+	case EventWar:
+		gs.applyWar(*e.War)
+	case EventIncome:
+		gs.applyIncome(e)
+	case EventOrderFailed:
+		if e.Player == gs.GetUsername() {
+			fmt.Printf("Your order for %s was cancelled: %s\n", e.To, e.Reason)
+		}
+	}
+	return true
+}
+
+func (gs *GameState) applySpawn(e Event) {
+	if e.Player != gs.GetUsername() {
+		return
+	}
+	gs.mu.Lock()
+	gs.resources += e.Resources
+	gs.mu.Unlock()
+	for _, unit := range e.Units {
+		gs.addUnit(unit)
+		fmt.Printf("Spawned a(n) %s in %s with id %v\n", unit.Rank, unit.Location, unit.ID)
+	}
+}
+
+func (gs *GameState) applyIncome(e Event) {
+	if e.Player != gs.GetUsername() {
+		return
+	}
+	gs.mu.Lock()
+	gs.resources += e.Resources
+	balance := gs.resources
+	gs.mu.Unlock()
+	fmt.Printf("You earned %d resource(s) and now have %d.\n", e.Resources, balance)
+}
+
+func (gs *GameState) applyMove(e Event) {
+	if e.Player == gs.GetUsername() {
+		for _, unit := range e.Units {
+			gs.UpdateUnit(unit)
+		}
+		fmt.Printf("Moved %v units to %s\n", len(e.Units), e.To)
+		return
+	}
+
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Move Detected ====")
+	fmt.Printf("%s is moving %v unit(s) to %s\n", e.Player, len(e.Units), e.To)
+	for _, unit := range e.Units {
+		fmt.Printf("* %v\n", unit.Rank)
+	}
+}
+
+func (gs *GameState) applyWar(war WarResult) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== War Declared ====")
+	fmt.Printf("%s has declared war on %s in %s!\n", war.Attacker, war.Defender, war.Location)
+	for username, lost := range war.Casualties {
+		fmt.Printf("%s lost %d unit(s)\n", username, len(lost))
+	}
+	for username, retreated := range war.Retreated {
+		fmt.Printf("%s retreated %d unit(s) to %s\n", username, len(retreated), retreated[0].Location)
+	}
+	if war.Winner == "" {
+		fmt.Println("The war ended in a draw!")
+	} else {
+		fmt.Printf("%s has won the war!\n", war.Winner)
+	}
+
+	if war.Loser == gs.GetUsername() {
+		fmt.Println("You have lost the war!")
+	}
+	lost := war.Casualties[gs.GetUsername()]
+	retreated := war.Retreated[gs.GetUsername()]
+	gs.mu.Lock()
+	for _, unit := range lost {
+		delete(gs.Player.Units, unit.ID)
+	}
+	for _, unit := range retreated {
+		gs.Player.Units[unit.ID] = unit
+	}
+	gs.mu.Unlock()
+	if len(lost) > 0 {
+		fmt.Printf("%d of your units in %s have been killed.\n", len(lost), war.Location)
+	}
+	if len(retreated) > 0 {
+		fmt.Printf("%d of your units fell back to %s.\n", len(retreated), retreated[0].Location)
+	}
+}
@@ -0,0 +1,213 @@
+package gamelogic
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Battle is a war about to be fought in Location.
+type Battle struct {
+	Attacker      string
+	Defender      string
+	Location      Location
+	AttackerUnits []Unit
+	DefenderUnits []Unit
+	// AttackerRetreat and DefenderRetreat are where each side's survivors
+	// can fall back to, or empty if they have nowhere to go.
+	AttackerRetreat Location
+	DefenderRetreat Location
+}
+
+// CombatResolver decides the outcome of battles. The World records the
+// result, so a resolver is free to be random.
+type CombatResolver interface {
+	Resolve(b Battle) WarResult
+}
+
+const (
+	CombatPower = "power"
+	CombatDice  = "dice"
+)
+
+// NewCombatResolver returns the resolver called name. seed only applies to
+// random resolvers; 0 seeds them from the clock.
+func NewCombatResolver(name string, seed uint64) (CombatResolver, error) {
+	switch name {
+	case CombatPower:
+		return PowerResolver{}, nil
+	case CombatDice:
+		if seed == 0 {
+			seed = uint64(time.Now().UnixNano())
+		}
+		return NewDiceResolver(seed), nil
+	}
+	return nil, fmt.Errorf("unknown combat resolver %q, expected %s or %s", name, CombatPower, CombatDice)
+}
+
+// PowerResolver is the original, deterministic model: the side with more
+// power wins and the loser loses every unit in the location. A draw kills
+// both sides.
+type PowerResolver struct{}
+
+func (PowerResolver) Resolve(b Battle) WarResult {
+	result := newWarResult(b)
+	attackerPower := unitsToPowerLevel(b.AttackerUnits)
+	defenderPower := unitsToPowerLevel(b.DefenderUnits)
+	switch {
+	case attackerPower > defenderPower:
+		result.Winner, result.Loser = b.Attacker, b.Defender
+		result.Casualties[b.Defender] = b.DefenderUnits
+	case defenderPower > attackerPower:
+		result.Winner, result.Loser = b.Defender, b.Attacker
+		result.Casualties[b.Attacker] = b.AttackerUnits
+	default:
+		result.Casualties[b.Attacker] = b.AttackerUnits
+		result.Casualties[b.Defender] = b.DefenderUnits
+	}
+	return result
+}
+
+// DiceResolver fights in rounds. Each round every unit rolls a die plus its
+// rank's bonus, the highest rolls on each side are paired off and the lower
+// of each pair dies, with ties going to the defender. A side that has lost
+// half its units retreats if it can, and an attacker still fighting after
+// diceMaxRounds falls back.
+type DiceResolver struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+const diceMaxRounds = 5
+
+// rankBonus is added to every roll a unit makes.
+var rankBonus = map[UnitRank]int{
+	RankInfantry:  0,
+	RankCavalry:   1,
+	RankArtillery: 2,
+}
+
+// counters gives each rank a bonus against the rank it counters. Cavalry
+// only has it in open terrain.
+var counters = map[UnitRank]UnitRank{
+	RankCavalry:   RankArtillery,
+	RankArtillery: RankInfantry,
+	RankInfantry:  RankCavalry,
+}
+
+const counterBonus = 2
+
+// roughDefenceBonus is added to defenders' rolls in rough terrain.
+const roughDefenceBonus = 1
+
+func NewDiceResolver(seed uint64) *DiceResolver {
+	return &DiceResolver{rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+type fighter struct {
+	unit Unit
+	roll int
+}
+
+func (r *DiceResolver) Resolve(b Battle) WarResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := newWarResult(b)
+	attackers := slices.Clone(b.AttackerUnits)
+	defenders := slices.Clone(b.DefenderUnits)
+
+	for round := 1; len(attackers) > 0 && len(defenders) > 0; round++ {
+		result.Rounds = round
+		a := r.roll(attackers, b.Location, false)
+		d := r.roll(defenders, b.Location, true)
+		for i := 0; i < min(len(a), len(d)); i++ {
+			ab := a[i].roll + counterAgainst(a[i].unit.Rank, d[i].unit.Rank, b.Location)
+			db := d[i].roll + counterAgainst(d[i].unit.Rank, a[i].unit.Rank, b.Location)
+			if ab > db {
+				result.Casualties[b.Defender] = append(result.Casualties[b.Defender], d[i].unit)
+				defenders = removeUnit(defenders, d[i].unit.ID)
+			} else {
+				result.Casualties[b.Attacker] = append(result.Casualties[b.Attacker], a[i].unit)
+				attackers = removeUnit(attackers, a[i].unit.ID)
+			}
+		}
+
+		switch {
+		case len(attackers) == 0 || len(defenders) == 0:
+		case b.AttackerRetreat != "" && (halved(attackers, b.AttackerUnits) || round >= diceMaxRounds):
+			result.retreat(b.Attacker, attackers, b.AttackerRetreat)
+			attackers = nil
+		case b.DefenderRetreat != "" && halved(defenders, b.DefenderUnits):
+			result.retreat(b.Defender, defenders, b.DefenderRetreat)
+			defenders = nil
+		}
+	}
+
+	switch {
+	case len(attackers) > 0:
+		result.Winner, result.Loser = b.Attacker, b.Defender
+	case len(defenders) > 0:
+		result.Winner, result.Loser = b.Defender, b.Attacker
+	case len(result.Retreated[b.Attacker]) > 0:
+		result.Winner, result.Loser = b.Defender, b.Attacker
+	case len(result.Retreated[b.Defender]) > 0:
+		result.Winner, result.Loser = b.Attacker, b.Defender
+	}
+	return result
+}
+
+// roll returns the units' rolls, highest first.
+func (r *DiceResolver) roll(units []Unit, loc Location, defending bool) []fighter {
+	fighters := make([]fighter, len(units))
+	for i, unit := range units {
+		roll := r.rng.IntN(6) + 1 + rankBonus[unit.Rank]
+		if defending && terrain[loc] == TerrainRough {
+			roll += roughDefenceBonus
+		}
+		fighters[i] = fighter{unit: unit, roll: roll}
+	}
+	sort.SliceStable(fighters, func(i, j int) bool {
+		return fighters[i].roll > fighters[j].roll
+	})
+	return fighters
+}
+
+func counterAgainst(rank, enemy UnitRank, loc Location) int {
+	if counters[rank] != enemy {
+		return 0
+	}
+	if rank == RankCavalry && terrain[loc] != TerrainOpen {
+		return 0
+	}
+	return counterBonus
+}
+
+func halved(left, started []Unit) bool {
+	return 2*len(left) <= len(started)
+}
+
+func removeUnit(units []Unit, id int) []Unit {
+	return slices.DeleteFunc(units, func(u Unit) bool { return u.ID == id })
+}
+
+func newWarResult(b Battle) WarResult {
+	return WarResult{
+		Attacker:   b.Attacker,
+		Defender:   b.Defender,
+		Location:   b.Location,
+		Casualties: map[string][]Unit{},
+	}
+}
+
+func (r *WarResult) retreat(player string, units []Unit, to Location) {
+	if r.Retreated == nil {
+		r.Retreated = map[string][]Unit{}
+	}
+	for _, unit := range units {
+		unit.Location = to
+		r.Retreated[player] = append(r.Retreated[player], unit)
+	}
+}
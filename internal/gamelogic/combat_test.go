@@ -0,0 +1,168 @@
+package gamelogic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testUnits(loc Location, ranks ...UnitRank) []Unit {
+	units := make([]Unit, len(ranks))
+	for i, rank := range ranks {
+		units[i] = Unit{ID: i + 1, Rank: rank, Location: loc}
+	}
+	return units
+}
+
+func TestPowerResolver(t *testing.T) {
+	tests := []struct {
+		name          string
+		attacker      []UnitRank
+		defender      []UnitRank
+		wantWinner    string
+		wantAttackers int
+		wantDefenders int
+	}{
+		{"stronger attacker", []UnitRank{RankArtillery}, []UnitRank{RankInfantry}, "a", 0, 1},
+		{"stronger defender", []UnitRank{RankInfantry}, []UnitRank{RankCavalry}, "d", 1, 0},
+		{"draw", []UnitRank{RankCavalry}, []UnitRank{RankCavalry}, "", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := PowerResolver{}.Resolve(Battle{
+				Attacker:      "a",
+				Defender:      "d",
+				Location:      "europe",
+				AttackerUnits: testUnits("europe", tt.attacker...),
+				DefenderUnits: testUnits("europe", tt.defender...),
+			})
+			if r.Winner != tt.wantWinner {
+				t.Errorf("winner = %q, want %q", r.Winner, tt.wantWinner)
+			}
+			if len(r.Casualties["a"]) != tt.wantAttackers || len(r.Casualties["d"]) != tt.wantDefenders {
+				t.Errorf("casualties = %d/%d, want %d/%d", len(r.Casualties["a"]), len(r.Casualties["d"]), tt.wantAttackers, tt.wantDefenders)
+			}
+		})
+	}
+}
+
+func TestCounterAgainst(t *testing.T) {
+	tests := []struct {
+		rank  UnitRank
+		enemy UnitRank
+		loc   Location
+		want  int
+	}{
+		{RankCavalry, RankArtillery, "europe", counterBonus},
+		{RankCavalry, RankArtillery, "asia", 0},
+		{RankArtillery, RankInfantry, "asia", counterBonus},
+		{RankInfantry, RankCavalry, "asia", counterBonus},
+		{RankInfantry, RankArtillery, "europe", 0},
+		{RankCavalry, RankCavalry, "europe", 0},
+	}
+	for _, tt := range tests {
+		if got := counterAgainst(tt.rank, tt.enemy, tt.loc); got != tt.want {
+			t.Errorf("counterAgainst(%s, %s, %s) = %d, want %d", tt.rank, tt.enemy, tt.loc, got, tt.want)
+		}
+	}
+}
+
+func TestDiceRoughDefence(t *testing.T) {
+	units := testUnits("asia", RankInfantry, RankCavalry, RankArtillery)
+	open := NewDiceResolver(1).roll(units, "europe", true)
+	rough := NewDiceResolver(1).roll(units, "asia", true)
+	attacking := NewDiceResolver(1).roll(units, "asia", false)
+	for i := range open {
+		if rough[i].roll != open[i].roll+roughDefenceBonus {
+			t.Errorf("rough defence roll %d = %d, want %d", i, rough[i].roll, open[i].roll+roughDefenceBonus)
+		}
+		if attacking[i].roll != open[i].roll {
+			t.Errorf("rough attack roll %d = %d, want %d", i, attacking[i].roll, open[i].roll)
+		}
+	}
+}
+
+// TestDiceResolver pins the outcome of battles for fixed seeds, so changes
+// to the rules show up here.
+func TestDiceResolver(t *testing.T) {
+	cavalry := []UnitRank{RankCavalry, RankCavalry, RankCavalry}
+	artillery := []UnitRank{RankArtillery, RankArtillery, RankArtillery}
+	tests := []struct {
+		name           string
+		seed           uint64
+		loc            Location
+		attacker       []UnitRank
+		defender       []UnitRank
+		retreat        bool
+		wantWinner     string
+		wantRounds     int
+		wantCasualties [2]int
+		wantRetreated  [2]int
+	}{
+		{
+			name: "cavalry counters artillery in the open", seed: 1, loc: "europe",
+			attacker: cavalry, defender: artillery,
+			wantWinner: "a", wantRounds: 2, wantCasualties: [2]int{1, 3},
+		},
+		{
+			name: "cavalry loses its counter in rough terrain", seed: 1, loc: "asia",
+			attacker: cavalry, defender: artillery,
+			wantWinner: "d", wantRounds: 1, wantCasualties: [2]int{3, 0},
+		},
+		{
+			name: "halved attacker retreats", seed: 1, loc: "europe", retreat: true,
+			attacker:   []UnitRank{RankInfantry, RankInfantry, RankInfantry, RankInfantry},
+			defender:   []UnitRank{RankArtillery, RankArtillery},
+			wantWinner: "d", wantRounds: 1, wantCasualties: [2]int{2, 0}, wantRetreated: [2]int{2, 0},
+		},
+		{
+			name: "halved defender retreats", seed: 2, loc: "europe", retreat: true,
+			attacker:   []UnitRank{RankArtillery, RankArtillery},
+			defender:   []UnitRank{RankInfantry, RankInfantry, RankInfantry, RankInfantry},
+			wantWinner: "a", wantRounds: 1, wantCasualties: [2]int{0, 2}, wantRetreated: [2]int{0, 2},
+		},
+		{
+			name: "no retreat without somewhere to go", seed: 1, loc: "europe",
+			attacker:   []UnitRank{RankInfantry, RankInfantry, RankInfantry, RankInfantry},
+			defender:   []UnitRank{RankArtillery, RankArtillery},
+			wantWinner: "d", wantRounds: 2, wantCasualties: [2]int{4, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Battle{
+				Attacker:      "a",
+				Defender:      "d",
+				Location:      tt.loc,
+				AttackerUnits: testUnits(tt.loc, tt.attacker...),
+				DefenderUnits: testUnits(tt.loc, tt.defender...),
+			}
+			if tt.retreat {
+				b.AttackerRetreat, b.DefenderRetreat = "americas", "africa"
+			}
+			r := NewDiceResolver(tt.seed).Resolve(b)
+			if again := NewDiceResolver(tt.seed).Resolve(b); !reflect.DeepEqual(r, again) {
+				t.Fatalf("seed %d gave different results:\n%+v\n%+v", tt.seed, r, again)
+			}
+
+			if r.Winner != tt.wantWinner {
+				t.Errorf("winner = %q, want %q", r.Winner, tt.wantWinner)
+			}
+			if r.Rounds != tt.wantRounds {
+				t.Errorf("rounds = %d, want %d", r.Rounds, tt.wantRounds)
+			}
+			if got := [2]int{len(r.Casualties["a"]), len(r.Casualties["d"])}; got != tt.wantCasualties {
+				t.Errorf("casualties = %v, want %v", got, tt.wantCasualties)
+			}
+			if got := [2]int{len(r.Retreated["a"]), len(r.Retreated["d"])}; got != tt.wantRetreated {
+				t.Errorf("retreated = %v, want %v", got, tt.wantRetreated)
+			}
+			for player, to := range map[string]Location{"a": b.AttackerRetreat, "d": b.DefenderRetreat} {
+				for _, unit := range r.Retreated[player] {
+					if unit.Location != to {
+						t.Errorf("%s's unit %d retreated to %s, want %s", player, unit.ID, unit.Location, to)
+					}
+				}
+			}
+		})
+	}
+}
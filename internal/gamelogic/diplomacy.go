@@ -0,0 +1,262 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+type PactKind string
+
+const (
+	// PactAlliance lets both players' units share locations in peace.
+	PactAlliance PactKind = "alliance"
+	// PactNonAggression stops either player moving into locations the
+	// other has units in.
+	PactNonAggression PactKind = "nonaggression"
+)
+
+type DiplomacyAction string
+
+const (
+	DiplomacyPropose DiplomacyAction = "propose"
+	DiplomacyAccept  DiplomacyAction = "accept"
+	DiplomacyBreak   DiplomacyAction = "break"
+)
+
+// Diplomacy is one player proposing, accepting or breaking a pact with
+// another. The server sends each one it accepts to both players.
+type Diplomacy struct {
+	From   string
+	To     string
+	Action DiplomacyAction
+	Pact   PactKind
+}
+
+// Pact is an agreement between two players, listed in sorted order.
+type Pact struct {
+	Players [2]string
+	Kind    PactKind
+}
+
+func newPact(a, b string, kind PactKind) Pact {
+	return Pact{Players: pair(a, b), Kind: kind}
+}
+
+// pair keys the pact between a and b the same way round for both.
+func pair(a, b string) [2]string {
+	if b < a {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+func (p Pact) other(username string) string {
+	if p.Players[0] == username {
+		return p.Players[1]
+	}
+	return p.Players[0]
+}
+
+// Diplomacy applies a proposal, acceptance or break between two players.
+func (w *World) Diplomacy(d Diplomacy) ([]Event, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.checkDiplomacy(d); err != nil {
+		return nil, err
+	}
+	w.applyDiplomacy(d)
+	return []Event{w.event(EventDiplomacy, d.From, func(e *Event) {
+		e.Diplomacy = &d
+	})}, nil
+}
+
+// checkDiplomacy must be called with w.mu held.
+func (w *World) checkDiplomacy(d Diplomacy) error {
+	if err := checkPact(d.From, d.To, d.Pact); err != nil {
+		return err
+	}
+	if _, ok := w.players[d.To]; !ok {
+		return fmt.Errorf("%s has not joined the game", d.To)
+	}
+	if w.over != nil {
+		return errors.New("the game is over")
+	}
+
+	current, ok := w.pacts[pair(d.From, d.To)]
+	switch d.Action {
+	case DiplomacyPropose:
+		if ok && current == d.Pact {
+			return fmt.Errorf("you already have a(n) %s with %s", d.Pact, d.To)
+		}
+	case DiplomacyAccept:
+		if w.proposals[[2]string{d.To, d.From}] != d.Pact {
+			return fmt.Errorf("%s has not proposed a(n) %s", d.To, d.Pact)
+		}
+	case DiplomacyBreak:
+		if !ok || current != d.Pact {
+			return fmt.Errorf("you have no %s with %s", d.Pact, d.To)
+		}
+	default:
+		return fmt.Errorf("%q is not a diplomatic action", d.Action)
+	}
+	return nil
+}
+
+func checkPact(a, b string, kind PactKind) error {
+	if kind != PactAlliance && kind != PactNonAggression {
+		return fmt.Errorf("%q is not a pact, expected %s or %s", kind, PactAlliance, PactNonAggression)
+	}
+	if a == "" || b == "" {
+		return errors.New("a pact needs two players")
+	}
+	if a == b {
+		return errors.New("you can not make a pact with yourself")
+	}
+	return nil
+}
+
+// applyDiplomacy must be called with w.mu held.
+func (w *World) applyDiplomacy(d Diplomacy) {
+	switch d.Action {
+	case DiplomacyPropose:
+		w.proposals[[2]string{d.From, d.To}] = d.Pact
+	case DiplomacyAccept:
+		delete(w.proposals, [2]string{d.From, d.To})
+		delete(w.proposals, [2]string{d.To, d.From})
+		w.pacts[pair(d.From, d.To)] = d.Pact
+	case DiplomacyBreak:
+		delete(w.pacts, pair(d.From, d.To))
+	}
+}
+
+// atPeace reports whether two players have any pact. It must be called with
+// w.mu held.
+func (w *World) atPeace(a, b string) bool {
+	_, ok := w.pacts[pair(a, b)]
+	return ok
+}
+
+// enemies lists the players in loc that player could go to war with. It
+// must be called with w.mu held.
+func (w *World) enemies(loc Location, player string) []string {
+	return slices.DeleteFunc(w.occupants(loc, player), func(name string) bool {
+		return w.atPeace(player, name)
+	})
+}
+
+// checkNonAggression must be called with w.mu held.
+func (w *World) checkNonAggression(username string, to Location) error {
+	for _, name := range w.occupants(to, username) {
+		if w.pacts[pair(username, name)] == PactNonAggression {
+			return fmt.Errorf("you have a non-aggression pact with %s, who holds units in %s", name, to)
+		}
+	}
+	return nil
+}
+
+// pactsOf must be called with w.mu held.
+func (w *World) pactsOf(username string) []Pact {
+	pacts := []Pact{}
+	for players, kind := range w.pacts {
+		if players[0] == username || players[1] == username {
+			pacts = append(pacts, Pact{Players: players, Kind: kind})
+		}
+	}
+	sortPacts(pacts)
+	return pacts
+}
+
+// proposalsTo must be called with w.mu held.
+func (w *World) proposalsTo(username string) []Diplomacy {
+	proposals := []Diplomacy{}
+	for key, kind := range w.proposals {
+		if key[1] == username {
+			proposals = append(proposals, Diplomacy{From: key[0], To: key[1], Action: DiplomacyPropose, Pact: kind})
+		}
+	}
+	sort.Slice(proposals, func(i, j int) bool { return proposals[i].From < proposals[j].From })
+	return proposals
+}
+
+func sortPacts(pacts []Pact) {
+	sort.Slice(pacts, func(i, j int) bool {
+		a, b := pacts[i].Players, pacts[j].Players
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		return a[1] < b[1]
+	})
+}
+
+func (gs *GameState) CommandDiplomacy(words []string) (Diplomacy, error) {
+	if len(words) < 3 {
+		return Diplomacy{}, fmt.Errorf("usage: %s <username> <%s|%s>", words[0], PactAlliance, PactNonAggression)
+	}
+	d := Diplomacy{
+		From:   gs.GetUsername(),
+		To:     words[1],
+		Action: DiplomacyAction(words[0]),
+		Pact:   PactKind(words[2]),
+	}
+	if d.Pact != PactAlliance && d.Pact != PactNonAggression {
+		return Diplomacy{}, fmt.Errorf("error: %s is not a pact, expected %s or %s", d.Pact, PactAlliance, PactNonAggression)
+	}
+	if d.To == d.From {
+		return Diplomacy{}, errors.New("error: you can not make a pact with yourself")
+	}
+	return d, nil
+}
+
+// HandleDiplomacy keeps the player's view of their pacts up to date and
+// tells them what happened.
+func (gs *GameState) HandleDiplomacy(d Diplomacy) {
+	me := gs.GetUsername()
+	other := d.To
+	if d.To == me {
+		other = d.From
+	}
+	gs.mu.Lock()
+	switch d.Action {
+	case DiplomacyPropose:
+		if d.To == me {
+			gs.proposals = append(slices.DeleteFunc(gs.proposals, func(p Diplomacy) bool { return p.From == d.From }), d)
+		}
+	case DiplomacyAccept:
+		gs.proposals = slices.DeleteFunc(gs.proposals, func(p Diplomacy) bool { return p.From == other })
+		gs.pacts = append(slices.DeleteFunc(gs.pacts, func(p Pact) bool { return p.other(me) == other }), newPact(me, other, d.Pact))
+	case DiplomacyBreak:
+		gs.pacts = slices.DeleteFunc(gs.pacts, func(p Pact) bool { return p.other(me) == other })
+	}
+	sortPacts(gs.pacts)
+	gs.mu.Unlock()
+
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Diplomacy ====")
+	switch {
+	case d.Action == DiplomacyPropose && d.From == me:
+		fmt.Printf("You proposed a(n) %s to %s.\n", d.Pact, other)
+	case d.Action == DiplomacyPropose:
+		fmt.Printf("%s proposes a(n) %s. Accept with: accept %s %s\n", other, d.Pact, other, d.Pact)
+	case d.Action == DiplomacyAccept:
+		fmt.Printf("You and %s are now in a(n) %s.\n", other, d.Pact)
+	case d.Action == DiplomacyBreak && d.From == me:
+		fmt.Printf("You broke your %s with %s.\n", d.Pact, other)
+	case d.Action == DiplomacyBreak:
+		fmt.Printf("%s broke their %s with you!\n", other, d.Pact)
+	}
+}
+
+func (gs *GameState) printPacts() {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	me := gs.Player.Username
+	for _, p := range gs.pacts {
+		fmt.Printf("You have a(n) %s with %s.\n", p.Kind, p.other(me))
+	}
+	for _, d := range gs.proposals {
+		fmt.Printf("%s has proposed a(n) %s.\n", d.From, d.Pact)
+	}
+}
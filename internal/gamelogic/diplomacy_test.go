@@ -0,0 +1,146 @@
+package gamelogic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiplomacy(t *testing.T) {
+	propose := func(from, to string, kind PactKind) Diplomacy {
+		return Diplomacy{From: from, To: to, Action: DiplomacyPropose, Pact: kind}
+	}
+	accept := func(from, to string, kind PactKind) Diplomacy {
+		return Diplomacy{From: from, To: to, Action: DiplomacyAccept, Pact: kind}
+	}
+	breakPact := func(from, to string, kind PactKind) Diplomacy {
+		return Diplomacy{From: from, To: to, Action: DiplomacyBreak, Pact: kind}
+	}
+	alliance := []Pact{newPact("alice", "bob", PactAlliance)}
+
+	tests := []struct {
+		name  string
+		steps []Diplomacy
+		// wantErr is whether the last step fails; every other step must
+		// succeed.
+		wantErr       bool
+		wantPacts     []Pact
+		wantProposals []Diplomacy
+	}{
+		{
+			name:          "propose",
+			steps:         []Diplomacy{propose("alice", "bob", PactAlliance)},
+			wantProposals: []Diplomacy{propose("alice", "bob", PactAlliance)},
+		},
+		{
+			name:      "accept",
+			steps:     []Diplomacy{propose("alice", "bob", PactAlliance), accept("bob", "alice", PactAlliance)},
+			wantPacts: alliance,
+		},
+		{
+			name:    "accept without a proposal",
+			steps:   []Diplomacy{accept("bob", "alice", PactAlliance)},
+			wantErr: true,
+		},
+		{
+			name:          "accept your own proposal",
+			steps:         []Diplomacy{propose("alice", "bob", PactAlliance), accept("alice", "bob", PactAlliance)},
+			wantErr:       true,
+			wantProposals: []Diplomacy{propose("alice", "bob", PactAlliance)},
+		},
+		{
+			name:          "accept a different pact",
+			steps:         []Diplomacy{propose("alice", "bob", PactAlliance), accept("bob", "alice", PactNonAggression)},
+			wantErr:       true,
+			wantProposals: []Diplomacy{propose("alice", "bob", PactAlliance)},
+		},
+		{
+			name:      "propose the pact you have",
+			steps:     []Diplomacy{propose("alice", "bob", PactAlliance), accept("bob", "alice", PactAlliance), propose("bob", "alice", PactAlliance)},
+			wantErr:   true,
+			wantPacts: alliance,
+		},
+		{
+			name: "replace a pact",
+			steps: []Diplomacy{
+				propose("alice", "bob", PactAlliance), accept("bob", "alice", PactAlliance),
+				propose("bob", "alice", PactNonAggression), accept("alice", "bob", PactNonAggression),
+			},
+			wantPacts: []Pact{newPact("alice", "bob", PactNonAggression)},
+		},
+		{
+			name:  "break",
+			steps: []Diplomacy{propose("alice", "bob", PactAlliance), accept("bob", "alice", PactAlliance), breakPact("bob", "alice", PactAlliance)},
+		},
+		{
+			name:    "break without a pact",
+			steps:   []Diplomacy{breakPact("alice", "bob", PactAlliance)},
+			wantErr: true,
+		},
+		{
+			name:    "with yourself",
+			steps:   []Diplomacy{propose("alice", "alice", PactAlliance)},
+			wantErr: true,
+		},
+		{
+			name:    "with a stranger",
+			steps:   []Diplomacy{propose("alice", "carol", PactAlliance)},
+			wantErr: true,
+		},
+		{
+			name:    "unknown pact",
+			steps:   []Diplomacy{propose("alice", "bob", "truce")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testWorld(nil, "alice", "bob")
+			for i, d := range tt.steps {
+				_, err := w.Diplomacy(d)
+				wantErr := tt.wantErr && i == len(tt.steps)-1
+				if (err != nil) != wantErr {
+					t.Fatalf("step %d: Diplomacy(%+v) error = %v, want error %t", i+1, d, err, wantErr)
+				}
+			}
+			s := w.Snapshot()
+			if !reflect.DeepEqual(s.Pacts, tt.wantPacts) {
+				t.Errorf("pacts = %v, want %v", s.Pacts, tt.wantPacts)
+			}
+			if !reflect.DeepEqual(s.Proposals, tt.wantProposals) {
+				t.Errorf("proposals = %v, want %v", s.Proposals, tt.wantProposals)
+			}
+		})
+	}
+}
+
+func TestMoveRespectsPacts(t *testing.T) {
+	tests := []struct {
+		name    string
+		pact    PactKind
+		wantErr bool
+		wantWar bool
+	}{
+		{"no pact", "", false, true},
+		{"alliance", PactAlliance, false, false},
+		{"non-aggression", PactNonAggression, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testWorld(map[Location]string{"europe": "alice", "asia": "bob"})
+			if tt.pact != "" {
+				w.pacts[pair("alice", "bob")] = tt.pact
+			}
+			events, err := w.Move(MoveCommand{Username: "bob", ToLocation: "europe", UnitIDs: []int{1}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Move error = %v, want error %t", err, tt.wantErr)
+			}
+			war := false
+			for _, e := range events {
+				war = war || e.Kind == EventWar
+			}
+			if war != tt.wantWar {
+				t.Errorf("war = %t, want %t", war, tt.wantWar)
+			}
+		})
+	}
+}
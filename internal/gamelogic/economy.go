@@ -0,0 +1,177 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// startingResources is what every player starts with.
+const startingResources = 10
+
+var unitCosts = map[UnitRank]int{
+	RankInfantry:  1,
+	RankCavalry:   3,
+	RankArtillery: 5,
+}
+
+// territoryIncome is what holding each location earns per payout.
+var territoryIncome = map[Location]int{
+	"americas":   3,
+	"europe":     3,
+	"africa":     2,
+	"asia":       4,
+	"australia":  2,
+	"antarctica": 1,
+}
+
+type ResourcesQuery struct {
+	Username string
+}
+
+type ResourcesReport struct {
+	Balance     int
+	Income      int
+	Territories []Location
+	Regions     []string
+	Costs       map[UnitRank]int
+}
+
+// income must be called with w.mu held.
+func (w *World) income(username string) int {
+	total := 0
+	for _, loc := range w.territories(username) {
+		total += territoryIncome[loc]
+	}
+	for _, r := range w.heldRegions(username) {
+		total += r.Bonus
+	}
+	return total
+}
+
+// available is the player's balance less what their queued spawns will
+// cost. It must be called with w.mu held.
+func (w *World) available(username string) int {
+	balance := w.balances[username]
+	for _, cmd := range w.orders.spawns {
+		if cmd.Username == username {
+			balance -= unitCosts[cmd.Rank]
+		}
+	}
+	return balance
+}
+
+// claims is the territory the player holds plus wherever their queued
+// spawns will land. It must be called with w.mu held.
+func (w *World) claims(username string) []Location {
+	locs := w.territories(username)
+	for _, cmd := range w.orders.spawns {
+		if cmd.Username == username && !slices.Contains(locs, cmd.Location) {
+			locs = append(locs, cmd.Location)
+		}
+	}
+	slices.Sort(locs)
+	return locs
+}
+
+// checkEconomy checks the player can afford the spawn and holds the
+// location. Players without any territory, or queued spawns to claim some,
+// may claim one anywhere nobody holds. It must be called with w.mu held.
+func (w *World) checkEconomy(cmd SpawnCommand) error {
+	w.player(cmd.Username)
+	cost := unitCosts[cmd.Rank]
+	if available := w.available(cmd.Username); available < cost {
+		return fmt.Errorf("not enough resources: a(n) %s costs %d, you have %d", cmd.Rank, cost, available)
+	}
+	claims := w.claims(cmd.Username)
+	switch owner := w.owners[cmd.Location]; {
+	case owner == cmd.Username:
+	case owner != "":
+		return fmt.Errorf("%s is held by %s", cmd.Location, owner)
+	case len(claims) > 0 && !slices.Contains(claims, cmd.Location):
+		return fmt.Errorf("you can only spawn units in territory you hold: %s", joinLocations(claims))
+	}
+	return nil
+}
+
+// PayIncome credits every player with the income from the territory they
+// hold, one event per player that earned any.
+func (w *World) PayIncome() []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.payIncome()
+}
+
+// payIncome must be called with w.mu held.
+func (w *World) payIncome() []Event {
+	if w.over != nil {
+		return nil
+	}
+	names := make([]string, 0, len(w.players))
+	for name := range w.players {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	events := []Event{}
+	for _, name := range names {
+		income := w.income(name)
+		if income == 0 {
+			continue
+		}
+		w.balances[name] += income
+		events = append(events, w.event(EventIncome, name, func(e *Event) {
+			e.Resources = income
+		}))
+	}
+	return events
+}
+
+func (w *World) Resources(q ResourcesQuery) (ResourcesReport, error) {
+	if q.Username == "" {
+		return ResourcesReport{}, errors.New("a username is required")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.player(q.Username)
+	report := ResourcesReport{
+		Balance:     w.available(q.Username),
+		Income:      w.income(q.Username),
+		Territories: w.territories(q.Username),
+		Costs:       unitCosts,
+	}
+	for _, r := range w.heldRegions(q.Username) {
+		report.Regions = append(report.Regions, r.Name)
+	}
+	return report, nil
+}
+
+func (gs *GameState) checkResources(rank UnitRank) error {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	if cost := unitCosts[rank]; gs.resources < cost {
+		return fmt.Errorf("not enough resources: a(n) %s costs %d, you have %d", rank, cost, gs.resources)
+	}
+	return nil
+}
+
+func PrintResourcesReport(r ResourcesReport) {
+	fmt.Printf("You have %d resource(s) and earn %d per payout.\n", r.Balance, r.Income)
+	if len(r.Territories) == 0 {
+		fmt.Println("You hold no territory; your first units can be spawned anywhere nobody else holds.")
+	} else {
+		fmt.Printf("You hold: %s\n", joinLocations(r.Territories))
+	}
+	for _, name := range r.Regions {
+		fmt.Printf("You hold all of the %s and earn its bonus.\n", name)
+	}
+	ranks := make([]UnitRank, 0, len(r.Costs))
+	for rank := range r.Costs {
+		ranks = append(ranks, rank)
+	}
+	slices.Sort(ranks)
+	fmt.Println("Unit costs:")
+	for _, rank := range ranks {
+		fmt.Printf("* %s: %d\n", rank, r.Costs[rank])
+	}
+}
@@ -0,0 +1,57 @@
+package gamelogic
+
+import "testing"
+
+func TestQueueSpawnClaims(t *testing.T) {
+	tests := []struct {
+		name    string
+		spawns  []SpawnCommand
+		wantErr []bool
+	}{
+		{
+			name: "second unclaimed location",
+			spawns: []SpawnCommand{
+				{"alice", "europe", RankInfantry},
+				{"alice", "asia", RankInfantry},
+			},
+			wantErr: []bool{false, true},
+		},
+		{
+			name: "same location twice",
+			spawns: []SpawnCommand{
+				{"alice", "europe", RankInfantry},
+				{"alice", "europe", RankCavalry},
+			},
+			wantErr: []bool{false, false},
+		},
+		{
+			name: "other players claim their own",
+			spawns: []SpawnCommand{
+				{"alice", "europe", RankInfantry},
+				{"bob", "asia", RankInfantry},
+				{"bob", "africa", RankInfantry},
+			},
+			wantErr: []bool{false, false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld()
+			for i, cmd := range tt.spawns {
+				_, err := w.QueueSpawn(cmd)
+				if (err != nil) != tt.wantErr[i] {
+					t.Fatalf("QueueSpawn(%v) error = %v, want error %t", cmd, err, tt.wantErr[i])
+				}
+			}
+			w.EndTurn()
+			for _, username := range []string{"alice", "bob"} {
+				w.mu.Lock()
+				held := w.territories(username)
+				w.mu.Unlock()
+				if len(held) > 1 {
+					t.Errorf("%s holds %v after one turn, want at most one location", username, held)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package gamelogic
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type EventKind string
+
+const (
+	EventSpawn  EventKind = "spawn"
+	EventMove   EventKind = "move"
+	EventWar    EventKind = "war"
+	EventPause  EventKind = "pause"
+	EventResume EventKind = "resume"
+	// EventTurn marks the end of a turn in turn-based games.
+	EventTurn   EventKind = "turn"
+	EventIncome EventKind = "income"
+	// EventGameOver ends the game; Player is the winner, if any.
+	EventGameOver EventKind = "game_over"
+	// EventDiplomacy is a pact proposed, accepted or broken by Player.
+	EventDiplomacy EventKind = "diplomacy"
+	// EventOrderFailed is a spawn or move into To queued by Player that
+	// could no longer be made when the turn ended.
+	EventOrderFailed EventKind = "order_failed"
+)
+
+// Event is an authoritative change to the world, numbered by the server in
+// the order it happened.
+type Event struct {
+	Seq    uint64
+	Time   time.Time
+	Kind   EventKind
+	Player string
+	// Units are the units spawned or moved.
+	Units []Unit     `json:",omitempty"`
+	To    Location   `json:",omitempty"`
+	War   *WarResult `json:",omitempty"`
+	Turn  int        `json:",omitempty"`
+	// Resources is the change to the player's balance.
+	Resources int        `json:",omitempty"`
+	GameOver  *GameOver  `json:",omitempty"`
+	Diplomacy *Diplomacy `json:",omitempty"`
+	// Reason is why an order failed.
+	Reason string `json:",omitempty"`
+}
+
+func (e Event) String() string {
+	prefix := fmt.Sprintf("#%d %s", e.Seq, e.Time.Format(time.RFC3339))
+	switch e.Kind {
+	case EventSpawn:
+		return fmt.Sprintf("%s %s spawned %s in %s", prefix, e.Player, describeUnits(e.Units), e.Units[0].Location)
+	case EventMove:
+		return fmt.Sprintf("%s %s moved %s to %s", prefix, e.Player, describeUnits(e.Units), e.To)
+	case EventWar:
+		if e.War.Winner == "" {
+			return fmt.Sprintf("%s %s and %s drew a war in %s", prefix, e.War.Attacker, e.War.Defender, e.War.Location)
+		}
+		return fmt.Sprintf("%s %s won a war against %s in %s", prefix, e.War.Winner, e.War.Loser, e.War.Location)
+	case EventPause:
+		return prefix + " game paused"
+	case EventResume:
+		return prefix + " game resumed"
+	case EventTurn:
+		return fmt.Sprintf("%s turn %d ended", prefix, e.Turn)
+	case EventIncome:
+		return fmt.Sprintf("%s %s earned %d resource(s)", prefix, e.Player, e.Resources)
+	case EventGameOver:
+		if e.Player == "" {
+			return prefix + " game over, tied"
+		}
+		return fmt.Sprintf("%s game over, %s won: they %s", prefix, e.Player, e.GameOver.Reason)
+	case EventDiplomacy:
+		d := e.Diplomacy
+		switch d.Action {
+		case DiplomacyPropose:
+			return fmt.Sprintf("%s %s proposed a(n) %s to %s", prefix, d.From, d.Pact, d.To)
+		case DiplomacyAccept:
+			return fmt.Sprintf("%s %s accepted a(n) %s with %s", prefix, d.From, d.Pact, d.To)
+		}
+		return fmt.Sprintf("%s %s broke their %s with %s", prefix, d.From, d.Pact, d.To)
+	case EventOrderFailed:
+		return fmt.Sprintf("%s %s's order for %s failed: %s", prefix, e.Player, e.To, e.Reason)
+	}
+	return fmt.Sprintf("%s %s", prefix, e.Kind)
+}
+
+func describeUnits(units []Unit) string {
+	parts := make([]string, len(units))
+	for i, unit := range units {
+		parts[i] = fmt.Sprintf("%s %d", unit.Rank, unit.ID)
+	}
+	return strings.Join(parts, ", ")
+}
+
+type WarResult struct {
+	Attacker string
+	Defender string
+	Location Location
+	// Winner and Loser are empty when the war was a draw.
+	Winner string
+	Loser  string
+	// Casualties are the units each player lost.
+	Casualties map[string][]Unit
+	// Retreated are the units each player pulled out, at their new
+	// location.
+	Retreated map[string][]Unit `json:",omitempty"`
+	Rounds    int               `json:",omitempty"`
+}
+
+type JoinCommand struct {
+	Username string
+}
+
+// JoinResult is the player's canonical state as of event Seq.
+type JoinResult struct {
+	Player    Player
+	Paused    bool
+	Seq       uint64
+	Resources int
+	// Turn is the turn in progress in turn-based games.
+	Turn *TurnState `json:",omitempty"`
+	// Pacts are the player's pacts and Proposals the ones offered to them.
+	Pacts     []Pact      `json:",omitempty"`
+	Proposals []Diplomacy `json:",omitempty"`
+	GameOver  *GameOver   `json:",omitempty"`
+}
+
+type SpawnCommand struct {
+	Username string
+	Location Location
+	Rank     UnitRank
+}
+
+type MoveCommand struct {
+	Username   string
+	ToLocation Location
+	UnitIDs    []int
+}
+
+// CommandResult acknowledges a command; its effects arrive as events up to
+// Seq. In turn-based games the command is queued instead and Turn is the
+// turn it will happen at the end of.
+type CommandResult struct {
+	Seq  uint64
+	Turn int `json:",omitempty"`
+}
@@ -19,17 +19,6 @@ type Unit struct {
 	Location Location
 }
 
-type ArmyMove struct {
-	Player     Player
-	Units      []Unit
-	ToLocation Location
-}
-
-type RecognitionOfWar struct {
-	Attacker Player
-	Defender Player
-}
-
 type Location string
 
 func getAllRanks() map[UnitRank]struct{} {
@@ -12,12 +12,30 @@ import (
 func PrintClientHelp() {
 	fmt.Println("Possible commands:")
 	fmt.Println("* move <location> <unitID> <unitID> <unitID>...")
+	fmt.Println("    units can only move to a location next to theirs, see map")
 	fmt.Println("    example:")
 	fmt.Println("    move asia 1")
 	fmt.Println("* spawn <location> <rank>")
+	fmt.Println("    costs resources, and only works in territory you hold once you hold any")
 	fmt.Println("    example:")
 	fmt.Println("    spawn europe infantry")
 	fmt.Println("* status")
+	fmt.Println("* ready")
+	fmt.Println("    in turn-based games, end your turn early")
+	fmt.Println("* propose <username> <alliance|nonaggression>")
+	fmt.Println("    allies share locations without going to war; non-aggression")
+	fmt.Println("    partners can not move into locations the other holds units in")
+	fmt.Println("    example:")
+	fmt.Println("    propose washington alliance")
+	fmt.Println("* accept <username> <alliance|nonaggression>")
+	fmt.Println("* break <username> <alliance|nonaggression>")
+	fmt.Println("* map")
+	fmt.Println("* resources")
+	fmt.Println("* units <username> [location]")
+	fmt.Println("    example:")
+	fmt.Println("    units washington europe")
+	fmt.Println("* save <file>")
+	fmt.Println("* load <file>")
 	fmt.Println("* spam <n>")
 	fmt.Println("    example:")
 	fmt.Println("    spam 5")
@@ -42,6 +60,15 @@ func PrintServerHelp() {
 	fmt.Println("Possible commands:")
 	fmt.Println("* pause")
 	fmt.Println("* resume")
+	fmt.Println("* status")
+	fmt.Println("* history [count]")
+	fmt.Println("* standings")
+	fmt.Println("* replay <username> [event]")
+	fmt.Println("* snapshot <file>")
+	fmt.Println("* dlq list")
+	fmt.Println("* dlq show <n>")
+	fmt.Println("* dlq replay <n|all>")
+	fmt.Println("* dlq purge")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
@@ -83,10 +110,17 @@ func (gs *GameState) CommandStatus() {
 	} else {
 		fmt.Println("The game is not paused.")
 	}
+	gs.mu.RLock()
+	turn := gs.turn
+	gs.mu.RUnlock()
+	if turn.Turn > 0 {
+		fmt.Printf("It is turn %d.\n", turn.Turn)
+	}
 
 	p := gs.GetPlayerSnap()
 	fmt.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
 	for _, unit := range p.Units {
 		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
 	}
+	gs.printPacts()
 }
@@ -8,6 +8,14 @@ type GameState struct {
 	Player Player
 	Paused bool
 	mu     *sync.RWMutex
+	// seq is the last server event applied.
+	seq uint64
+	// turn is the latest turn broadcast, in turn-based games.
+	turn      TurnState
+	resources int
+	pacts     []Pact
+	// proposals are the pacts other players have offered this one.
+	proposals []Diplomacy
 }
 
 func NewGameState(username string) *GameState {
@@ -45,16 +53,6 @@ func (gs *GameState) addUnit(u Unit) {
 	gs.Player.Units[u.ID] = u
 }
 
-func (gs *GameState) removeUnitsInLocation(loc Location) {
-	gs.mu.Lock()
-	defer gs.mu.Unlock()
-	for k, v := range gs.Player.Units {
-		if v.Location == loc {
-			delete(gs.Player.Units, k)
-		}
-	}
-}
-
 func (gs *GameState) UpdateUnit(u Unit) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
@@ -0,0 +1,144 @@
+package gamelogic
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// EventLog is an append-only history of the world, one JSON event per line.
+type EventLog struct {
+	mu     sync.Mutex
+	path   string
+	f      *os.File
+	events []Event
+}
+
+// OpenEventLog reads the events already in path and opens it for appending.
+// A final line cut short by a crash is dropped from the file.
+func OpenEventLog(path string) (*EventLog, error) {
+	l := &EventLog{path: path}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open history file: %v", err)
+	}
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				if err := f.Truncate(offset); err != nil {
+					f.Close()
+					return nil, fmt.Errorf("could not drop incomplete event: %v", err)
+				}
+			}
+			break
+		} else if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not read history file: %v", err)
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		l.events = append(l.events, e)
+		offset += int64(len(line))
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not open history file: %v", err)
+	}
+	l.f = f
+	return l, nil
+}
+
+// Append writes events to the end of the log and syncs it to disk.
+func (l *EventLog) Append(events ...Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return fmt.Errorf("history %s is closed", l.path)
+	}
+	buf := []byte{}
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("could not encode event %d: %v", e.Seq, err)
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+	if _, err := l.f.Write(buf); err != nil {
+		return fmt.Errorf("could not write history file: %v", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("could not sync history file: %v", err)
+	}
+	l.events = append(l.events, events...)
+	return nil
+}
+
+// Events returns every event in the log, oldest first.
+func (l *EventLog) Events() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.events)
+}
+
+func (l *EventLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// ReplayRange picks what events can be replayed from: the snapshot the game
+// resumed from, unless the log goes back to the first event. first and last
+// are the events that can be replayed up to; last is 0 when there are none.
+func ReplayRange(s Snapshot, events []Event) (base Snapshot, first, last uint64) {
+	base = s
+	if len(events) > 0 && events[0].Seq == 1 {
+		base = Snapshot{Version: SnapshotVersion}
+	}
+	first, last = max(base.Seq, 1), base.Seq
+	if len(events) > 0 {
+		last = max(last, events[len(events)-1].Seq)
+	}
+	return base, first, last
+}
+
+// Replay rebuilds username's game state as it was after event upTo, or
+// after the last event when upTo is 0, starting from the snapshot the
+// events were recorded after.
+func Replay(s Snapshot, events []Event, username string, upTo uint64) (*GameState, error) {
+	if upTo > 0 {
+		n, _ := slices.BinarySearchFunc(events, upTo+1, func(e Event, seq uint64) int {
+			return cmp.Compare(e.Seq, seq)
+		})
+		events = events[:n]
+	}
+	w, err := RestoreSnapshot(s, events)
+	if err != nil {
+		return nil, err
+	}
+	jr, err := w.Join(username)
+	if err != nil {
+		return nil, err
+	}
+	gs := NewGameState(username)
+	gs.Load(jr)
+	return gs, nil
+}
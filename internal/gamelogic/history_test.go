@@ -0,0 +1,177 @@
+package gamelogic
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// playGame spawns units for alice and bob, returning the world and every
+// event it produced.
+func playGame(t *testing.T) (*World, []Event) {
+	t.Helper()
+	w := NewWorld()
+	events := []Event{}
+	for _, cmd := range []SpawnCommand{
+		{"alice", "europe", RankInfantry},
+		{"bob", "asia", RankCavalry},
+		{"alice", "europe", RankArtillery},
+	} {
+		evs, err := w.Spawn(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, evs...)
+	}
+	evs, err := w.Diplomacy(Diplomacy{From: "alice", To: "bob", Action: DiplomacyPropose, Pact: PactAlliance})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, append(events, evs...)
+}
+
+func TestEventLogDropsIncompleteEvent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	_, events := playGame(t)
+	l, err := OpenEventLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(events[:2]...); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A crash mid-write leaves half an event behind.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Seq":3,"Kind":"sp`)
+	f.Close()
+
+	l, err = OpenEventLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(l.Events()); got != 2 {
+		t.Fatalf("reopened log has %d event(s), want 2", got)
+	}
+	if after, _ := os.Stat(path); after.Size() != info.Size() {
+		t.Errorf("file is %d bytes, want %d after dropping the incomplete event", after.Size(), info.Size())
+	}
+	if err := l.Append(events[2:]...); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	l, err = OpenEventLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if got := l.Events(); len(got) != len(events) || got[2].Seq != 3 {
+		t.Errorf("log has %d event(s) after appending, want %d in order", len(got), len(events))
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	w, events := playGame(t)
+	s := w.Snapshot()
+	path := filepath.Join(t.TempDir(), "snapshot")
+	if err := WriteSnapshot(path, s); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, s) {
+		t.Errorf("read back %+v, want %+v", read, s)
+	}
+	restored, err := RestoreSnapshot(read, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.Snapshot(); !reflect.DeepEqual(got, s) {
+		t.Errorf("restored world has %+v, want %+v", got, s)
+	}
+
+	s.Version++
+	if err := WriteSnapshot(path, s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSnapshot(path); err == nil {
+		t.Error("read a snapshot from another version")
+	}
+}
+
+func TestReplayRange(t *testing.T) {
+	_, events := playGame(t)
+	snapshot := Snapshot{Version: SnapshotVersion, Seq: 2}
+	tests := []struct {
+		name      string
+		snapshot  Snapshot
+		events    []Event
+		wantSeq   uint64
+		wantFirst uint64
+		wantLast  uint64
+	}{
+		{"nothing recorded", Snapshot{Version: SnapshotVersion}, nil, 0, 1, 0},
+		{"full history", Snapshot{Version: SnapshotVersion}, events, 0, 1, 4},
+		{"full history ignores the snapshot", snapshot, events, 0, 1, 4},
+		{"history after the snapshot", snapshot, events[2:], 2, 2, 4},
+		{"snapshot alone", snapshot, nil, 2, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, first, last := ReplayRange(tt.snapshot, tt.events)
+			if base.Seq != tt.wantSeq || first != tt.wantFirst || last != tt.wantLast {
+				t.Errorf("ReplayRange = base %d, %d-%d, want base %d, %d-%d", base.Seq, first, last, tt.wantSeq, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	w, events := playGame(t)
+	mid, err := RestoreWorld(events[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		snapshot  Snapshot
+		events    []Event
+		upTo      uint64
+		wantUnits int
+	}{
+		{"first event", Snapshot{Version: SnapshotVersion}, events, 1, 1},
+		{"every event", Snapshot{Version: SnapshotVersion}, events, 0, 2},
+		{"the snapshot itself", mid.Snapshot(), events[2:], 2, 1},
+		{"on top of a snapshot", mid.Snapshot(), events[2:], 3, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs, err := Replay(tt.snapshot, tt.events, "alice", tt.upTo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(gs.getUnitsSnap()); got != tt.wantUnits {
+				t.Errorf("alice has %d unit(s), want %d", got, tt.wantUnits)
+			}
+		})
+	}
+
+	gs, err := Replay(Snapshot{Version: SnapshotVersion}, events, "alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := w.Snapshot().Seq; gs.seq != want {
+		t.Errorf("replayed state is at event %d, want %d", gs.seq, want)
+	}
+}
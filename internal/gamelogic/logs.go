@@ -2,19 +2,24 @@ package gamelogic
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
-
-	"github.com/thrashdev/bootdev-peril/internal/routing"
 )
 
 const logsFile = "game.log"
 
 const writeToDiskSleep = 1 * time.Second
 
-func WriteLog(gamelog routing.GameLog) error {
-	log.Printf("received game log...")
+func WriteLog(gamelog GameLog) (err error) {
+	slog.Debug("received game log", "username", gamelog.Username)
+	defer func() {
+		if err != nil {
+			gameLogsTotal.With("error").Inc()
+			return
+		}
+		gameLogsTotal.With("written").Inc()
+	}()
 	time.Sleep(writeToDiskSleep)
 
 	f, err := os.OpenFile(logsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -0,0 +1,26 @@
+package gamelogic
+
+import "github.com/thrashdev/bootdev-peril/internal/metrics"
+
+var (
+	movesTotal = metrics.NewCounterVec(
+		"peril_moves_total",
+		"Army moves accepted by the server, by whether they started a war.",
+		"outcome",
+	)
+	warsTotal = metrics.NewCounterVec(
+		"peril_wars_total",
+		"Wars resolved by the server, by outcome.",
+		"outcome",
+	)
+	pausesTotal = metrics.NewCounterVec(
+		"peril_pauses_total",
+		"Pause and resume commands received.",
+		"state",
+	)
+	gameLogsTotal = metrics.NewCounterVec(
+		"peril_game_logs_total",
+		"Game logs written to disk, by result.",
+		"result",
+	)
+)
@@ -0,0 +1,13 @@
+package gamelogic
+
+import "time"
+
+type PlayingState struct {
+	IsPaused bool
+}
+
+type GameLog struct {
+	CurrentTime time.Time
+	Message     string
+	Username    string
+}
@@ -2,17 +2,17 @@ package gamelogic
 
 import (
 	"fmt"
-
-	"github.com/thrashdev/bootdev-peril/internal/routing"
 )
 
-func (gs *GameState) HandlePause(ps routing.PlayingState) {
+func (gs *GameState) HandlePause(ps PlayingState) {
 	defer fmt.Println("------------------------")
 	fmt.Println()
 	if ps.IsPaused {
+		pausesTotal.With("paused").Inc()
 		fmt.Println("==== Pause Detected ====")
 		gs.pauseGame()
 	} else {
+		pausesTotal.With("resumed").Inc()
 		fmt.Println("==== Resume Detected ====")
 		gs.resumeGame()
 	}
@@ -0,0 +1,73 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// UnitsQuery asks a player which units they have, in Location or
+// everywhere when it's empty.
+type UnitsQuery struct {
+	Location Location
+}
+
+type UnitsReport struct {
+	Username string
+	Units    []Unit
+}
+
+type StatusQuery struct{}
+
+type StatusReport struct {
+	Username string
+	Units    int
+	Paused   bool
+}
+
+func (gs *GameState) CommandUnits(words []string) (string, UnitsQuery, error) {
+	if len(words) < 2 {
+		return "", UnitsQuery{}, errors.New("usage: units <username> [location]")
+	}
+	q := UnitsQuery{}
+	if len(words) > 2 {
+		q.Location = Location(words[2])
+		if _, ok := getAllLocations()[q.Location]; !ok {
+			return "", UnitsQuery{}, fmt.Errorf("error: %s is not a valid location", q.Location)
+		}
+	}
+	return words[1], q, nil
+}
+
+func (gs *GameState) HandleUnitsQuery(q UnitsQuery) (UnitsReport, error) {
+	if q.Location != "" {
+		if _, ok := getAllLocations()[q.Location]; !ok {
+			return UnitsReport{}, fmt.Errorf("%s is not a valid location", q.Location)
+		}
+	}
+	report := UnitsReport{Username: gs.GetUsername(), Units: []Unit{}}
+	for _, unit := range gs.getUnitsSnap() {
+		if q.Location == "" || unit.Location == q.Location {
+			report.Units = append(report.Units, unit)
+		}
+	}
+	sort.Slice(report.Units, func(i, j int) bool {
+		return report.Units[i].ID < report.Units[j].ID
+	})
+	return report, nil
+}
+
+func (gs *GameState) HandleStatusQuery(StatusQuery) StatusReport {
+	return StatusReport{
+		Username: gs.GetUsername(),
+		Units:    len(gs.getUnitsSnap()),
+		Paused:   gs.isPaused(),
+	}
+}
+
+func PrintUnitsReport(r UnitsReport) {
+	fmt.Printf("%s has %d unit(s):\n", r.Username, len(r.Units))
+	for _, unit := range r.Units {
+		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
+	}
+}
@@ -0,0 +1,255 @@
+package gamelogic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// SnapshotVersion is written to every snapshot; snapshots with any other
+// version are rejected.
+const SnapshotVersion = 1
+
+// Snapshot is the state of some or all players as of event Seq.
+type Snapshot struct {
+	Version int
+	Seq     uint64
+	Paused  bool
+	Turn    int `json:",omitempty"`
+	Players []Player
+	// NextIDs is the last unit ID handed out to each player, for worlds.
+	NextIDs map[string]int `json:",omitempty"`
+	// Balances are each player's resources. Players missing from it start
+	// afresh.
+	Balances map[string]int      `json:",omitempty"`
+	Owners   map[Location]string `json:",omitempty"`
+	Active   []string            `json:",omitempty"`
+	Pacts    []Pact              `json:",omitempty"`
+	// Proposals are pacts offered but not yet accepted.
+	Proposals []Diplomacy `json:",omitempty"`
+	GameOver  *GameOver   `json:",omitempty"`
+}
+
+// Validate rejects snapshots from other versions and ones with units that
+// are not in the game.
+func (s Snapshot) Validate() error {
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d, expected %d", s.Version, SnapshotVersion)
+	}
+	for loc := range s.Owners {
+		if _, ok := getAllLocations()[loc]; !ok {
+			return fmt.Errorf("unknown location %q has an owner", loc)
+		}
+	}
+	for _, p := range s.Pacts {
+		if err := checkPact(p.Players[0], p.Players[1], p.Kind); err != nil {
+			return fmt.Errorf("bad pact: %v", err)
+		}
+	}
+	for _, d := range s.Proposals {
+		if err := checkPact(d.From, d.To, d.Pact); err != nil {
+			return fmt.Errorf("bad proposal: %v", err)
+		}
+	}
+	seen := map[string]bool{}
+	for _, p := range s.Players {
+		if p.Username == "" {
+			return errors.New("snapshot has a player without a username")
+		}
+		if seen[p.Username] {
+			return fmt.Errorf("snapshot has %s twice", p.Username)
+		}
+		seen[p.Username] = true
+		if s.Balances[p.Username] < 0 {
+			return fmt.Errorf("%s has a negative balance", p.Username)
+		}
+		for id, unit := range p.Units {
+			if id != unit.ID || id < 1 {
+				return fmt.Errorf("%s has a unit with a bad ID %d", p.Username, id)
+			}
+			if _, ok := getAllRanks()[unit.Rank]; !ok {
+				return fmt.Errorf("%s's unit %d has unknown rank %q", p.Username, id, unit.Rank)
+			}
+			if _, ok := getAllLocations()[unit.Location]; !ok {
+				return fmt.Errorf("%s's unit %d is in unknown location %q", p.Username, id, unit.Location)
+			}
+			if s.NextIDs != nil && id > s.NextIDs[p.Username] {
+				return fmt.Errorf("%s's unit %d is newer than the last ID handed out", p.Username, id)
+			}
+		}
+	}
+	return nil
+}
+
+// WriteSnapshot replaces path with s, so a crash never leaves half a
+// snapshot behind.
+func WriteSnapshot(path string, s Snapshot) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not write snapshot: %v", err)
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write snapshot: %v", err)
+	}
+	return nil
+}
+
+func ReadSnapshot(path string) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("could not read snapshot: %v", err)
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Snapshot{}, fmt.Errorf("could not decode snapshot %s: %v", path, err)
+	}
+	if err := s.Validate(); err != nil {
+		return Snapshot{}, fmt.Errorf("invalid snapshot %s: %v", path, err)
+	}
+	return s, nil
+}
+
+func (gs *GameState) Snapshot() Snapshot {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return Snapshot{
+		Version:   SnapshotVersion,
+		Seq:       gs.seq,
+		Paused:    gs.Paused,
+		Players:   []Player{copyPlayer(&gs.Player)},
+		Balances:  map[string]int{gs.Player.Username: gs.resources},
+		Pacts:     slices.Clone(gs.pacts),
+		Proposals: slices.Clone(gs.proposals),
+	}
+}
+
+// Restore replaces the local state with the player's state in s. Where the
+// server's events are up to, and whether it is paused, are kept: s may be
+// from later on or another game, and events from the server must keep
+// applying.
+func (gs *GameState) Restore(s Snapshot) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	for _, p := range s.Players {
+		if p.Username == gs.GetUsername() {
+			balance, ok := s.Balances[p.Username]
+			if !ok {
+				balance = startingResources
+			}
+			gs.mu.RLock()
+			jr := JoinResult{Player: p, Paused: gs.Paused, Seq: gs.seq, Resources: balance}
+			gs.mu.RUnlock()
+			for _, pact := range s.Pacts {
+				if pact.Players[0] == p.Username || pact.Players[1] == p.Username {
+					jr.Pacts = append(jr.Pacts, pact)
+				}
+			}
+			for _, d := range s.Proposals {
+				if d.To == p.Username {
+					jr.Proposals = append(jr.Proposals, d)
+				}
+			}
+			gs.Load(jr)
+			return nil
+		}
+	}
+	return fmt.Errorf("snapshot has no state for %s", gs.GetUsername())
+}
+
+func (w *World) Snapshot() Snapshot {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := Snapshot{
+		Version:  SnapshotVersion,
+		Seq:      w.seq,
+		Paused:   w.paused,
+		Turn:     w.turn,
+		Players:  make([]Player, 0, len(w.players)),
+		NextIDs:  make(map[string]int, len(w.nextIDs)),
+		Balances: make(map[string]int, len(w.balances)),
+	}
+	for _, p := range w.players {
+		s.Players = append(s.Players, copyPlayer(p))
+	}
+	sort.Slice(s.Players, func(i, j int) bool {
+		return s.Players[i].Username < s.Players[j].Username
+	})
+	for username, id := range w.nextIDs {
+		s.NextIDs[username] = id
+	}
+	for username, balance := range w.balances {
+		s.Balances[username] = balance
+	}
+	s.Owners = make(map[Location]string, len(w.owners))
+	for loc, owner := range w.owners {
+		s.Owners[loc] = owner
+	}
+	for username := range w.active {
+		s.Active = append(s.Active, username)
+	}
+	slices.Sort(s.Active)
+	for players, kind := range w.pacts {
+		s.Pacts = append(s.Pacts, Pact{Players: players, Kind: kind})
+	}
+	sortPacts(s.Pacts)
+	for key, kind := range w.proposals {
+		s.Proposals = append(s.Proposals, Diplomacy{From: key[0], To: key[1], Action: DiplomacyPropose, Pact: kind})
+	}
+	sort.Slice(s.Proposals, func(i, j int) bool {
+		if s.Proposals[i].From != s.Proposals[j].From {
+			return s.Proposals[i].From < s.Proposals[j].From
+		}
+		return s.Proposals[i].To < s.Proposals[j].To
+	})
+	s.GameOver = w.over
+	return s
+}
+
+func (gs *GameState) CommandSave(words []string) error {
+	if len(words) < 2 {
+		return errors.New("usage: save <file>")
+	}
+	s := gs.Snapshot()
+	if err := WriteSnapshot(words[1], s); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %d unit(s) to %s\n", len(s.Players[0].Units), words[1])
+	return nil
+}
+
+// CommandLoad replaces the local state with a saved one. The server's state
+// is unchanged; it is restored again on the next join.
+func (gs *GameState) CommandLoad(words []string) error {
+	if len(words) < 2 {
+		return errors.New("usage: load <file>")
+	}
+	s, err := ReadSnapshot(words[1])
+	if err != nil {
+		return err
+	}
+	if err := gs.Restore(s); err != nil {
+		return err
+	}
+	fmt.Printf("Loaded %d unit(s) from %s\n", len(gs.getUnitsSnap()), words[1])
+	return nil
+}
@@ -5,30 +5,29 @@ import (
 	"fmt"
 )
 
-func (gs *GameState) CommandSpawn(words []string) error {
+func (gs *GameState) CommandSpawn(words []string) (SpawnCommand, error) {
 	if len(words) < 3 {
-		return errors.New("usage: spawn <location> <rank>")
+		return SpawnCommand{}, errors.New("usage: spawn <location> <rank>")
 	}
 
 	locationName := words[1]
 	locations := getAllLocations()
 	if _, ok := locations[Location(locationName)]; !ok {
-		return fmt.Errorf("error: %s is not a valid location", locationName)
+		return SpawnCommand{}, fmt.Errorf("error: %s is not a valid location", locationName)
 	}
 
 	rank := words[2]
 	units := getAllRanks()
 	if _, ok := units[UnitRank(rank)]; !ok {
-		return fmt.Errorf("error: %s is not a valid unit", rank)
+		return SpawnCommand{}, fmt.Errorf("error: %s is not a valid unit", rank)
+	}
+	if err := gs.checkResources(UnitRank(rank)); err != nil {
+		return SpawnCommand{}, fmt.Errorf("error: %v", err)
 	}
 
-	id := len(gs.getUnitsSnap()) + 1
-	gs.addUnit(Unit{
-		ID:       id,
-		Rank:     UnitRank(rank),
+	return SpawnCommand{
+		Username: gs.GetUsername(),
 		Location: Location(locationName),
-	})
-
-	fmt.Printf("Spawned a(n) %s in %s with id %v\n", rank, locationName, id)
-	return nil
+		Rank:     UnitRank(rank),
+	}, nil
 }
@@ -0,0 +1,231 @@
+package gamelogic
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Region is a group of locations that pays Bonus on top of their income to
+// a player who holds all of them.
+type Region struct {
+	Name      string
+	Locations []Location
+	Bonus     int
+}
+
+var regions = []Region{
+	{Name: "old world", Locations: []Location{"europe", "africa", "asia"}, Bonus: 4},
+	{Name: "atlantic", Locations: []Location{"americas", "europe", "africa"}, Bonus: 3},
+	{Name: "southern seas", Locations: []Location{"africa", "australia", "antarctica"}, Bonus: 3},
+}
+
+// Victory configures how a game can be won. Zero values disable a
+// condition.
+type Victory struct {
+	// Territories wins the game for the first player to hold this many.
+	Territories int
+	// Elimination wins the game for the last player with units or
+	// territory, once at least two have played.
+	Elimination bool
+}
+
+type GameOver struct {
+	// Winner is empty when the game ended in a tie.
+	Winner string
+	Reason string
+	Scores map[string]int
+}
+
+// Owners returns who holds each location that has been claimed.
+func (w *World) Owners() map[Location]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	owners := make(map[Location]string, len(w.owners))
+	for loc, owner := range w.owners {
+		owners[loc] = owner
+	}
+	return owners
+}
+
+// Standing is a player's position in the game.
+type Standing struct {
+	Username    string
+	Territories []Location
+	Regions     []string
+	Units       int
+	Score       int
+}
+
+// updateOwners gives every location with a single player in it to that
+// player. Locations everyone has left stay with their last holder. It must
+// be called with w.mu held.
+func (w *World) updateOwners() {
+	for loc := range getAllLocations() {
+		if holders := w.occupants(loc, ""); len(holders) == 1 {
+			w.owners[loc] = holders[0]
+		}
+	}
+}
+
+// territories must be called with w.mu held.
+func (w *World) territories(username string) []Location {
+	locs := []Location{}
+	for loc, owner := range w.owners {
+		if owner == username {
+			locs = append(locs, loc)
+		}
+	}
+	slices.Sort(locs)
+	return locs
+}
+
+// heldRegions must be called with w.mu held.
+func (w *World) heldRegions(username string) []Region {
+	held := []Region{}
+	for _, r := range regions {
+		all := true
+		for _, loc := range r.Locations {
+			all = all && w.owners[loc] == username
+		}
+		if all {
+			held = append(held, r)
+		}
+	}
+	return held
+}
+
+// score is the player's income plus what their army cost. It must be called
+// with w.mu held.
+func (w *World) score(username string) int {
+	score := w.income(username)
+	for _, unit := range w.players[username].Units {
+		score += unitCosts[unit.Rank]
+	}
+	return score
+}
+
+func (w *World) Standings() []Standing {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.standings()
+}
+
+// standings must be called with w.mu held.
+func (w *World) standings() []Standing {
+	standings := make([]Standing, 0, len(w.players))
+	for name, p := range w.players {
+		s := Standing{
+			Username:    name,
+			Territories: w.territories(name),
+			Units:       len(p.Units),
+			Score:       w.score(name),
+		}
+		for _, r := range w.heldRegions(name) {
+			s.Regions = append(s.Regions, r.Name)
+		}
+		standings = append(standings, s)
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Score != standings[j].Score {
+			return standings[i].Score > standings[j].Score
+		}
+		return standings[i].Username < standings[j].Username
+	})
+	return standings
+}
+
+func (w *World) Over() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.over != nil
+}
+
+// CheckVictory ends the game if a player has met one of v's conditions,
+// returning the EventGameOver it recorded.
+func (w *World) CheckVictory(v Victory) (Event, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.over != nil {
+		return Event{}, false
+	}
+	if v.Territories > 0 {
+		for _, s := range w.standings() {
+			if len(s.Territories) >= v.Territories {
+				return w.endGame(s.Username, fmt.Sprintf("hold %d territories", len(s.Territories))), true
+			}
+		}
+	}
+	if v.Elimination && len(w.active) >= 2 {
+		alive := []string{}
+		for name := range w.active {
+			if len(w.players[name].Units) > 0 || len(w.territories(name)) > 0 {
+				alive = append(alive, name)
+			}
+		}
+		if len(alive) == 1 {
+			return w.endGame(alive[0], "eliminated every opponent"), true
+		}
+	}
+	return Event{}, false
+}
+
+// EndByScore ends the game in favour of the highest score, for when time
+// runs out.
+func (w *World) EndByScore() (Event, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.over != nil {
+		return Event{}, false
+	}
+	standings := w.standings()
+	winner := ""
+	if len(standings) == 1 || len(standings) > 1 && standings[0].Score > standings[1].Score {
+		winner = standings[0].Username
+	}
+	return w.endGame(winner, "had the highest score when time ran out"), true
+}
+
+// endGame must be called with w.mu held.
+func (w *World) endGame(winner, reason string) Event {
+	over := GameOver{Winner: winner, Reason: reason, Scores: map[string]int{}}
+	for name := range w.players {
+		over.Scores[name] = w.score(name)
+	}
+	w.over = &over
+	return w.event(EventGameOver, winner, func(e *Event) {
+		e.GameOver = &over
+	})
+}
+
+func (gs *GameState) HandleGameOver(over GameOver) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Game Over ====")
+	PrintGameOver(over, gs.GetUsername())
+}
+
+// PrintGameOver addresses the winner as "you" when they are username.
+func PrintGameOver(over GameOver, username string) {
+	switch over.Winner {
+	case "":
+		fmt.Println("Nobody won: the game ended in a tie.")
+	case username:
+		fmt.Printf("You won! You %s.\n", over.Reason)
+	default:
+		fmt.Printf("%s won: they %s.\n", over.Winner, over.Reason)
+	}
+	names := make([]string, 0, len(over.Scores))
+	for name := range over.Scores {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if over.Scores[names[i]] != over.Scores[names[j]] {
+			return over.Scores[names[i]] > over.Scores[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		fmt.Printf("* %s: %d\n", name, over.Scores[name])
+	}
+}
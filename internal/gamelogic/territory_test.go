@@ -0,0 +1,147 @@
+package gamelogic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testWorld returns a world where each player has an infantry unit in
+// every location they hold.
+func testWorld(owners map[Location]string, players ...string) *World {
+	w := NewWorld()
+	for _, name := range players {
+		w.player(name)
+		w.active[name] = true
+	}
+	for loc, owner := range owners {
+		p := w.player(owner)
+		w.nextIDs[owner]++
+		id := w.nextIDs[owner]
+		p.Units[id] = Unit{ID: id, Rank: RankInfantry, Location: loc}
+		w.active[owner] = true
+	}
+	w.updateOwners()
+	return w
+}
+
+func TestRegions(t *testing.T) {
+	tests := []struct {
+		name        string
+		held        []Location
+		wantRegions []string
+		wantIncome  int
+	}{
+		{"none", []Location{"europe", "africa"}, nil, 5},
+		{"old world", []Location{"europe", "africa", "asia"}, []string{"old world"}, 13},
+		{"atlantic", []Location{"americas", "europe", "africa"}, []string{"atlantic"}, 11},
+		{"overlapping", []Location{"americas", "europe", "africa", "asia"}, []string{"old world", "atlantic"}, 19},
+		{"southern seas", []Location{"africa", "australia", "antarctica"}, []string{"southern seas"}, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owners := map[Location]string{"americas": "bob"}
+			for _, loc := range tt.held {
+				owners[loc] = "alice"
+			}
+			w := testWorld(owners)
+			for _, s := range w.Standings() {
+				if s.Username != "alice" {
+					continue
+				}
+				if !reflect.DeepEqual(s.Regions, tt.wantRegions) {
+					t.Errorf("alice holds regions %v, want %v", s.Regions, tt.wantRegions)
+				}
+			}
+			w.mu.Lock()
+			income := w.income("alice")
+			w.mu.Unlock()
+			if income != tt.wantIncome {
+				t.Errorf("alice earns %d, want %d", income, tt.wantIncome)
+			}
+		})
+	}
+}
+
+func TestCheckVictory(t *testing.T) {
+	tests := []struct {
+		name       string
+		owners     map[Location]string
+		players    []string
+		victory    Victory
+		wantOver   bool
+		wantWinner string
+	}{
+		{
+			name:       "enough territories",
+			owners:     map[Location]string{"europe": "alice", "africa": "alice", "asia": "alice", "americas": "bob"},
+			victory:    Victory{Territories: 3},
+			wantOver:   true,
+			wantWinner: "alice",
+		},
+		{
+			name:    "too few territories",
+			owners:  map[Location]string{"europe": "alice", "africa": "alice", "americas": "bob"},
+			victory: Victory{Territories: 3},
+		},
+		{
+			name:       "last one standing",
+			owners:     map[Location]string{"europe": "alice"},
+			players:    []string{"bob"},
+			victory:    Victory{Elimination: true},
+			wantOver:   true,
+			wantWinner: "alice",
+		},
+		{
+			name:    "nobody to eliminate",
+			owners:  map[Location]string{"europe": "alice"},
+			victory: Victory{Elimination: true},
+		},
+		{
+			name:    "both standing",
+			owners:  map[Location]string{"europe": "alice", "asia": "bob"},
+			victory: Victory{Elimination: true},
+		},
+		{
+			name:    "disabled",
+			owners:  map[Location]string{"europe": "alice", "africa": "alice", "asia": "alice"},
+			players: []string{"bob"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testWorld(tt.owners, tt.players...)
+			e, over := w.CheckVictory(tt.victory)
+			if over != tt.wantOver {
+				t.Fatalf("game over = %t, want %t", over, tt.wantOver)
+			}
+			if !over {
+				return
+			}
+			if e.Kind != EventGameOver || e.GameOver.Winner != tt.wantWinner {
+				t.Errorf("got %v won by %q, want %q", e.Kind, e.GameOver.Winner, tt.wantWinner)
+			}
+			if _, again := w.CheckVictory(tt.victory); again {
+				t.Error("the game ended twice")
+			}
+		})
+	}
+}
+
+func TestEndByScore(t *testing.T) {
+	tests := []struct {
+		name       string
+		owners     map[Location]string
+		wantWinner string
+	}{
+		{"higher score", map[Location]string{"asia": "alice", "africa": "bob"}, "alice"},
+		{"tie", map[Location]string{"europe": "alice", "americas": "bob"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, over := testWorld(tt.owners).EndByScore()
+			if !over || e.GameOver.Winner != tt.wantWinner {
+				t.Errorf("EndByScore = %t won by %q, want %q", over, e.GameOver.Winner, tt.wantWinner)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// TurnState is broadcast when a turn starts and when it ends.
+type TurnState struct {
+	Turn  int
+	Ended bool
+	// Deadline is when a started turn ends unless every player is ready
+	// first.
+	Deadline time.Time `json:",omitempty"`
+}
+
+type ReadyCommand struct {
+	Username string
+}
+
+// orders are the commands queued to resolve together at the end of a turn.
+type orders struct {
+	spawns []SpawnCommand
+	moves  []MoveCommand
+}
+
+// Turn returns the number of the turn in progress.
+func (w *World) Turn() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.turn + 1
+}
+
+// QueueSpawn checks a spawn and holds it until EndTurn, returning the turn
+// it will happen in.
+func (w *World) QueueSpawn(cmd SpawnCommand) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.checkSpawn(cmd); err != nil {
+		return 0, err
+	}
+	w.orders.spawns = append(w.orders.spawns, cmd)
+	return w.turn + 1, nil
+}
+
+// QueueMove checks a move and holds it until EndTurn, returning the turn it
+// will happen in. Each unit can only be given one order per turn.
+func (w *World) QueueMove(cmd MoveCommand) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.checkMove(cmd); err != nil {
+		return 0, err
+	}
+	for _, queued := range w.orders.moves {
+		if queued.Username != cmd.Username {
+			continue
+		}
+		for _, id := range cmd.UnitIDs {
+			if slices.Contains(queued.UnitIDs, id) {
+				return 0, fmt.Errorf("unit with ID %v already has orders this turn", id)
+			}
+		}
+	}
+	w.orders.moves = append(w.orders.moves, cmd)
+	return w.turn + 1, nil
+}
+
+// EndTurn resolves the queued orders as if they happened at once: spawns
+// first, then every move, then a war wherever players arrived to meet.
+// Orders that are no longer valid fail with an EventOrderFailed. Income is
+// paid on the territory held after that, and it ends with an EventTurn
+// numbering the turn.
+func (w *World) EndTurn() []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	queued := w.orders
+	w.orders = orders{}
+
+	events := []Event{}
+	arrivals := map[Location][]string{}
+	arrive := func(loc Location, username string) {
+		if !slices.Contains(arrivals[loc], username) {
+			arrivals[loc] = append(arrivals[loc], username)
+		}
+	}
+	for _, cmd := range queued.spawns {
+		// Another player's spawn may have claimed the location first.
+		if err := w.checkSpawn(cmd); err != nil {
+			events = append(events, w.orderFailed(cmd.Username, cmd.Location, err))
+			continue
+		}
+		events = append(events, w.spawn(cmd))
+		arrive(cmd.Location, cmd.Username)
+	}
+	moves := map[Location]int{}
+	for _, cmd := range queued.moves {
+		units, err := w.checkMove(cmd)
+		if err != nil {
+			// Earlier orders may have moved or lost the units since.
+			events = append(events, w.orderFailed(cmd.Username, cmd.ToLocation, err))
+			continue
+		}
+		events = append(events, w.move(cmd, units))
+		arrive(cmd.ToLocation, cmd.Username)
+		moves[cmd.ToLocation]++
+	}
+	locs := make([]Location, 0, len(arrivals))
+	for loc := range arrivals {
+		locs = append(locs, loc)
+	}
+	slices.Sort(locs)
+	for _, loc := range locs {
+		wars := w.battle(loc, arrivals[loc])
+		outcome := "safe"
+		if len(wars) > 0 {
+			outcome = "war"
+		}
+		movesTotal.With(outcome).Add(float64(moves[loc]))
+		events = append(events, wars...)
+	}
+
+	events = append(events, w.payIncome()...)
+	w.turn++
+	return append(events, w.event(EventTurn, "", func(e *Event) {
+		e.Turn = w.turn
+	}))
+}
+
+// orderFailed must be called with w.mu held.
+func (w *World) orderFailed(username string, loc Location, err error) Event {
+	return w.event(EventOrderFailed, username, func(e *Event) {
+		e.To = loc
+		e.Reason = err.Error()
+	})
+}
+
+// battle fights wars in loc until the players left there are all at peace.
+// Players who arrived attack first, in the order they arrived. It must be
+// called with w.mu held.
+func (w *World) battle(loc Location, movers []string) []Event {
+	events := []Event{}
+	for {
+		present := w.occupants(loc, "")
+		attackers := []string{}
+		for _, name := range movers {
+			if slices.Contains(present, name) {
+				attackers = append(attackers, name)
+			}
+		}
+		for _, name := range present {
+			if !slices.Contains(attackers, name) {
+				attackers = append(attackers, name)
+			}
+		}
+		fought := false
+		for _, attacker := range attackers {
+			if enemies := w.enemies(loc, attacker); len(enemies) > 0 {
+				events = append(events, w.war(attacker, enemies[0], loc))
+				fought = true
+				break
+			}
+		}
+		if !fought {
+			return events
+		}
+	}
+}
+
+func (gs *GameState) HandleTurn(ts TurnState) {
+	gs.mu.Lock()
+	gs.turn = ts
+	gs.mu.Unlock()
+
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	if ts.Ended {
+		fmt.Printf("==== Turn %d Ended ====\n", ts.Turn)
+		return
+	}
+	fmt.Printf("==== Turn %d Started ====\n", ts.Turn)
+	fmt.Printf("Orders are resolved in %s, or once everyone is ready.\n", time.Until(ts.Deadline).Round(time.Second))
+}
+
+func (gs *GameState) CommandReady() (ReadyCommand, error) {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	if gs.turn.Turn == 0 {
+		return ReadyCommand{}, errors.New("the game is not turn-based")
+	}
+	return ReadyCommand{Username: gs.Player.Username}, nil
+}
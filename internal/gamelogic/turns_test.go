@@ -0,0 +1,80 @@
+package gamelogic
+
+import (
+	"strings"
+	"testing"
+)
+
+func failedOrders(events []Event) []Event {
+	failed := []Event{}
+	for _, e := range events {
+		if e.Kind == EventOrderFailed {
+			failed = append(failed, e)
+		}
+	}
+	return failed
+}
+
+func TestEndTurnRechecksOrders(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup runs before the orders are queued.
+		setup      func(t *testing.T, w *World)
+		spawns     []SpawnCommand
+		moves      []MoveCommand
+		wantPlayer string
+		wantReason string
+	}{
+		{
+			name: "spawn into a location claimed first",
+			spawns: []SpawnCommand{
+				{"alice", "europe", RankInfantry},
+				{"bob", "europe", RankInfantry},
+			},
+			wantPlayer: "bob",
+			wantReason: "europe is held by alice",
+		},
+		{
+			name: "move into a pact partner's arrival",
+			setup: func(t *testing.T, w *World) {
+				for _, cmd := range []SpawnCommand{{"alice", "europe", RankInfantry}, {"bob", "africa", RankInfantry}} {
+					if _, err := w.Spawn(cmd); err != nil {
+						t.Fatal(err)
+					}
+				}
+				w.pacts[pair("alice", "bob")] = PactNonAggression
+			},
+			moves: []MoveCommand{
+				{"alice", "asia", []int{1}},
+				{"bob", "asia", []int{1}},
+			},
+			wantPlayer: "bob",
+			wantReason: "non-aggression pact with alice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld()
+			if tt.setup != nil {
+				tt.setup(t, w)
+			}
+			for _, cmd := range tt.spawns {
+				if _, err := w.QueueSpawn(cmd); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, cmd := range tt.moves {
+				if _, err := w.QueueMove(cmd); err != nil {
+					t.Fatal(err)
+				}
+			}
+			failed := failedOrders(w.EndTurn())
+			if len(failed) != 1 {
+				t.Fatalf("%d order(s) failed, want 1", len(failed))
+			}
+			if failed[0].Player != tt.wantPlayer || !strings.Contains(failed[0].Reason, tt.wantReason) {
+				t.Errorf("%s's order failed with %q, want %s's with %q", failed[0].Player, failed[0].Reason, tt.wantPlayer, tt.wantReason)
+			}
+		})
+	}
+}
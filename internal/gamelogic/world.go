@@ -0,0 +1,413 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// World is the server's canonical view of every player. Clients only ever
+// learn about changes to it through the events its methods return.
+type World struct {
+	mu      sync.Mutex
+	players map[string]*Player
+	nextIDs map[string]int
+	// balances are each player's resources.
+	balances map[string]int
+	// owners are the last players to hold each location alone.
+	owners map[Location]string
+	// active are the players who have ever spawned a unit.
+	active map[string]bool
+	// pacts are the agreements between pairs of players, and proposals
+	// the ones offered but not yet accepted, keyed from proposer to
+	// recipient.
+	pacts     map[[2]string]PactKind
+	proposals map[[2]string]PactKind
+	over      *GameOver
+	paused    bool
+	seq       uint64
+	// turn is the number of turns that have ended.
+	turn   int
+	orders orders
+	combat CombatResolver
+}
+
+func NewWorld() *World {
+	return &World{
+		players:   map[string]*Player{},
+		nextIDs:   map[string]int{},
+		balances:  map[string]int{},
+		owners:    map[Location]string{},
+		active:    map[string]bool{},
+		pacts:     map[[2]string]PactKind{},
+		proposals: map[[2]string]PactKind{},
+		combat:    PowerResolver{},
+	}
+}
+
+// SetCombat changes how the world's wars are fought from now on.
+func (w *World) SetCombat(r CombatResolver) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.combat = r
+}
+
+// Join returns the player's state, adding them to the world if they are
+// new.
+func (w *World) Join(username string) (JoinResult, error) {
+	if username == "" {
+		return JoinResult{}, errors.New("a username is required")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p := w.player(username)
+	return JoinResult{
+		Player:    copyPlayer(p),
+		Paused:    w.paused,
+		Seq:       w.seq,
+		Resources: w.balances[username],
+		Pacts:     w.pactsOf(username),
+		Proposals: w.proposalsTo(username),
+		GameOver:  w.over,
+	}, nil
+}
+
+// RestoreWorld rebuilds a world by applying events in order. They must be
+// numbered from 1 without gaps, as World numbers them.
+func RestoreWorld(events []Event) (*World, error) {
+	return RestoreSnapshot(Snapshot{Version: SnapshotVersion}, events)
+}
+
+// RestoreSnapshot rebuilds a world from a snapshot and the events recorded
+// after it. Events the snapshot already covers are skipped.
+func RestoreSnapshot(s Snapshot, events []Event) (*World, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	w := NewWorld()
+	w.seq = s.Seq
+	w.paused = s.Paused
+	w.turn = s.Turn
+	for _, p := range s.Players {
+		restored := copyPlayer(&p)
+		w.players[p.Username] = &restored
+		w.balances[p.Username] = startingResources
+		if balance, ok := s.Balances[p.Username]; ok {
+			w.balances[p.Username] = balance
+		}
+		for id := range p.Units {
+			w.nextIDs[p.Username] = max(w.nextIDs[p.Username], id)
+		}
+	}
+	for username, id := range s.NextIDs {
+		w.nextIDs[username] = max(w.nextIDs[username], id)
+	}
+	for loc, owner := range s.Owners {
+		w.owners[loc] = owner
+	}
+	for _, username := range s.Active {
+		w.active[username] = true
+	}
+	for _, p := range s.Pacts {
+		w.pacts[p.Players] = p.Kind
+	}
+	for _, d := range s.Proposals {
+		w.proposals[[2]string{d.From, d.To}] = d.Pact
+	}
+	w.over = s.GameOver
+	w.updateOwners()
+
+	for _, e := range events {
+		if e.Seq <= s.Seq {
+			continue
+		}
+		if e.Seq != w.seq+1 {
+			return nil, fmt.Errorf("expected event %d, found %d", w.seq+1, e.Seq)
+		}
+		w.apply(e)
+	}
+	return w, nil
+}
+
+// apply must be called with w.mu held.
+func (w *World) apply(e Event) {
+	w.seq = e.Seq
+	switch e.Kind {
+	case EventSpawn:
+		p := w.player(e.Player)
+		for _, unit := range e.Units {
+			p.Units[unit.ID] = unit
+			w.nextIDs[e.Player] = max(w.nextIDs[e.Player], unit.ID)
+		}
+		w.balances[e.Player] += e.Resources
+		w.active[e.Player] = true
+	case EventIncome:
+		w.player(e.Player)
+		w.balances[e.Player] += e.Resources
+	case EventMove:
+		p := w.player(e.Player)
+		for _, unit := range e.Units {
+			p.Units[unit.ID] = unit
+		}
+	case EventWar:
+		w.applyWar(*e.War)
+	case EventPause:
+		w.paused = true
+	case EventResume:
+		w.paused = false
+	case EventTurn:
+		w.turn = e.Turn
+	case EventGameOver:
+		w.over = e.GameOver
+	case EventDiplomacy:
+		w.applyDiplomacy(*e.Diplomacy)
+	}
+	w.updateOwners()
+}
+
+func (w *World) Paused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.paused
+}
+
+func (w *World) SetPaused(paused bool) Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paused = paused
+	kind := EventResume
+	if paused {
+		kind = EventPause
+	}
+	return w.event(kind, "", func(*Event) {})
+}
+
+func (w *World) Spawn(cmd SpawnCommand) ([]Event, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.checkSpawn(cmd); err != nil {
+		return nil, err
+	}
+	return []Event{w.spawn(cmd)}, nil
+}
+
+// checkSpawn must be called with w.mu held.
+func (w *World) checkSpawn(cmd SpawnCommand) error {
+	if _, ok := getAllLocations()[cmd.Location]; !ok {
+		return fmt.Errorf("%s is not a valid location", cmd.Location)
+	}
+	if _, ok := getAllRanks()[cmd.Rank]; !ok {
+		return fmt.Errorf("%s is not a valid unit", cmd.Rank)
+	}
+	if w.over != nil {
+		return errors.New("the game is over")
+	}
+	if w.paused {
+		return errors.New("the game is paused, you can not spawn units")
+	}
+	return w.checkEconomy(cmd)
+}
+
+// spawn must be called with w.mu held.
+func (w *World) spawn(cmd SpawnCommand) Event {
+	p := w.player(cmd.Username)
+	w.nextIDs[cmd.Username]++
+	unit := Unit{ID: w.nextIDs[cmd.Username], Rank: cmd.Rank, Location: cmd.Location}
+	p.Units[unit.ID] = unit
+	cost := unitCosts[cmd.Rank]
+	w.balances[cmd.Username] -= cost
+	w.active[cmd.Username] = true
+	w.updateOwners()
+	return w.event(EventSpawn, cmd.Username, func(e *Event) {
+		e.Units = []Unit{unit}
+		e.Resources = -cost
+	})
+}
+
+// Move moves the player's units and fights every other player already in
+// the destination that they have no pact with, one at a time, until the
+// mover has no units left there.
+func (w *World) Move(cmd MoveCommand) ([]Event, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	units, err := w.checkMove(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []Event{w.move(cmd, units)}
+	for _, defender := range w.enemies(cmd.ToLocation, cmd.Username) {
+		if len(unitsIn(w.players[cmd.Username], cmd.ToLocation)) == 0 {
+			break
+		}
+		events = append(events, w.war(cmd.Username, defender, cmd.ToLocation))
+	}
+
+	outcome := "safe"
+	if len(events) > 1 {
+		outcome = "war"
+	}
+	movesTotal.With(outcome).Inc()
+	return events, nil
+}
+
+// checkMove returns the units cmd moves. It must be called with w.mu held.
+func (w *World) checkMove(cmd MoveCommand) ([]Unit, error) {
+	if _, ok := getAllLocations()[cmd.ToLocation]; !ok {
+		return nil, fmt.Errorf("%s is not a valid location", cmd.ToLocation)
+	}
+	if len(cmd.UnitIDs) == 0 {
+		return nil, errors.New("no units to move")
+	}
+	if w.over != nil {
+		return nil, errors.New("the game is over")
+	}
+	if w.paused {
+		return nil, errors.New("the game is paused, you can not move units")
+	}
+	p := w.player(cmd.Username)
+	units := []Unit{}
+	seen := map[int]bool{}
+	for _, id := range cmd.UnitIDs {
+		unit, ok := p.Units[id]
+		if !ok {
+			return nil, fmt.Errorf("unit with ID %v not found", id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("unit with ID %v is listed twice", id)
+		}
+		seen[id] = true
+		units = append(units, unit)
+	}
+	if err := checkReachable(units, cmd.ToLocation); err != nil {
+		return nil, err
+	}
+	if err := w.checkNonAggression(cmd.Username, cmd.ToLocation); err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+// move must be called with w.mu held.
+func (w *World) move(cmd MoveCommand, units []Unit) Event {
+	p := w.player(cmd.Username)
+	moved := make([]Unit, len(units))
+	for i, unit := range units {
+		unit.Location = cmd.ToLocation
+		p.Units[unit.ID] = unit
+		moved[i] = unit
+	}
+	w.updateOwners()
+	return w.event(EventMove, cmd.Username, func(e *Event) {
+		e.Units = moved
+		e.To = cmd.ToLocation
+	})
+}
+
+// war fights attacker's and defender's units in loc. It must be called with
+// w.mu held.
+func (w *World) war(attacker, defender string, loc Location) Event {
+	result := w.combat.Resolve(Battle{
+		Attacker:        attacker,
+		Defender:        defender,
+		Location:        loc,
+		AttackerUnits:   unitsIn(w.players[attacker], loc),
+		DefenderUnits:   unitsIn(w.players[defender], loc),
+		AttackerRetreat: w.retreatFrom(loc, attacker),
+		DefenderRetreat: w.retreatFrom(loc, defender),
+	})
+	w.applyWar(result)
+	w.updateOwners()
+	switch result.Winner {
+	case attacker:
+		warsTotal.With("attacker_won").Inc()
+	case defender:
+		warsTotal.With("defender_won").Inc()
+	default:
+		warsTotal.With("draw").Inc()
+	}
+	return w.event(EventWar, attacker, func(e *Event) {
+		e.War = &result
+	})
+}
+
+// applyWar must be called with w.mu held.
+func (w *World) applyWar(result WarResult) {
+	for username, lost := range result.Casualties {
+		p := w.player(username)
+		for _, unit := range lost {
+			delete(p.Units, unit.ID)
+		}
+	}
+	for username, retreated := range result.Retreated {
+		p := w.player(username)
+		for _, unit := range retreated {
+			p.Units[unit.ID] = unit
+		}
+	}
+}
+
+// retreatFrom picks the first location next to loc that no enemy of
+// player holds, or returns empty if there is none. It must be called with w.mu
+// held.
+func (w *World) retreatFrom(loc Location, player string) Location {
+	for _, n := range Neighbours(loc) {
+		if len(w.enemies(n, player)) == 0 {
+			return n
+		}
+	}
+	return ""
+}
+
+// player must be called with w.mu held.
+func (w *World) player(username string) *Player {
+	p, ok := w.players[username]
+	if !ok {
+		p = &Player{Username: username, Units: map[int]Unit{}}
+		w.players[username] = p
+		w.balances[username] = startingResources
+	}
+	return p
+}
+
+// event must be called with w.mu held.
+func (w *World) event(kind EventKind, player string, fill func(*Event)) Event {
+	w.seq++
+	e := Event{Seq: w.seq, Time: time.Now().UTC(), Kind: kind, Player: player}
+	fill(&e)
+	return e
+}
+
+// occupants lists the players other than except with units in loc, in a
+// stable order.
+func (w *World) occupants(loc Location, except string) []string {
+	names := []string{}
+	for name, p := range w.players {
+		if name != except && len(unitsIn(p, loc)) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func unitsIn(p *Player, loc Location) []Unit {
+	units := []Unit{}
+	for _, unit := range p.Units {
+		if unit.Location == loc {
+			units = append(units, unit)
+		}
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].ID < units[j].ID })
+	return units
+}
+
+func copyPlayer(p *Player) Player {
+	units := make(map[int]Unit, len(p.Units))
+	for id, unit := range p.Units {
+		units[id] = unit
+	}
+	return Player{Username: p.Username, Units: units}
+}
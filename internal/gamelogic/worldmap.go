@@ -0,0 +1,89 @@
+package gamelogic
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// adjacency lists the locations a unit can move to in one move. Every edge
+// is listed in both directions.
+var adjacency = map[Location][]Location{
+	"americas":   {"europe", "africa", "asia", "antarctica"},
+	"europe":     {"americas", "africa", "asia"},
+	"africa":     {"americas", "europe", "asia", "antarctica"},
+	"asia":       {"americas", "europe", "africa", "australia"},
+	"australia":  {"asia", "antarctica"},
+	"antarctica": {"americas", "africa", "australia"},
+}
+
+type Terrain string
+
+const (
+	TerrainOpen  Terrain = "open"
+	TerrainRough Terrain = "rough"
+)
+
+// terrain changes how battles in a location are fought, see DiceResolver.
+var terrain = map[Location]Terrain{
+	"americas":   TerrainOpen,
+	"europe":     TerrainOpen,
+	"africa":     TerrainOpen,
+	"asia":       TerrainRough,
+	"australia":  TerrainOpen,
+	"antarctica": TerrainRough,
+}
+
+// Neighbours returns the locations next to loc, sorted.
+func Neighbours(loc Location) []Location {
+	n := slices.Clone(adjacency[loc])
+	slices.Sort(n)
+	return n
+}
+
+func adjacent(from, to Location) bool {
+	return slices.Contains(adjacency[from], to)
+}
+
+// checkReachable returns an error unless every unit is already in to or
+// next to it.
+func checkReachable(units []Unit, to Location) error {
+	for _, unit := range units {
+		if unit.Location != to && !adjacent(unit.Location, to) {
+			return fmt.Errorf("unit %d can not reach %s from %s in one move, try one of: %s",
+				unit.ID, to, unit.Location, joinLocations(Neighbours(unit.Location)))
+		}
+	}
+	return nil
+}
+
+func joinLocations(locs []Location) string {
+	parts := make([]string, len(locs))
+	for i, loc := range locs {
+		parts[i] = string(loc)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (gs *GameState) CommandMap() {
+	byLocation := map[Location][]Unit{}
+	for _, unit := range gs.getUnitsSnap() {
+		byLocation[unit.Location] = append(byLocation[unit.Location], unit)
+	}
+	locs := make([]Location, 0, len(adjacency))
+	for loc := range adjacency {
+		locs = append(locs, loc)
+	}
+	slices.Sort(locs)
+
+	fmt.Println("==== Map ====")
+	for _, loc := range locs {
+		fmt.Printf("%s (%s) -> %s\n", loc, terrain[loc], joinLocations(Neighbours(loc)))
+		units := byLocation[loc]
+		sort.Slice(units, func(i, j int) bool { return units[i].ID < units[j].ID })
+		for _, unit := range units {
+			fmt.Printf("    * %v: %v\n", unit.ID, unit.Rank)
+		}
+	}
+}
@@ -0,0 +1,961 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	reconnectMinBackoff = 500 * time.Millisecond
+	reconnectMaxBackoff = 30 * time.Second
+	publishBufferSize   = 256
+)
+
+var ErrPublishBufferFull = errors.New("broker is unavailable and the publish buffer is full")
+
+// AMQPBroker is a Broker backed by RabbitMQ. It watches its connection and,
+// when the broker goes away, redials with exponential backoff, re-declares
+// every exchange and queue it knows about and restarts all consumers on the
+// channels originally returned by Consume. Publishes made during an outage
+// are buffered, up to publishBufferSize, and flushed once reconnected.
+type AMQPBroker struct {
+	url string
+	// user is the login in url, stamped on every publish as its user-id.
+	user   string
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	conn        *amqp.Connection
+	pubCh       *amqp.Channel
+	connected   bool
+	closed      bool
+	exchanges   []amqpExchange
+	queues      []amqpQueue
+	delayQueues []amqpDelayQueue
+	consumers   []*amqpConsumer
+	pending     []amqpPublish
+	ready       chan struct{}
+
+	// inspectCh holds messages fetched by Get until they are settled.
+	inspectCh *amqp.Channel
+
+	// confirmMu serialises confirmed publishes so that a basic.return seen
+	// before the ack always belongs to the message being waited on.
+	confirmMu   sync.Mutex
+	confirmConn *amqp.Connection
+	confirmCh   *amqp.Channel
+	returns     <-chan amqp.Return
+
+	done       chan struct{}
+	lifecycles sync.WaitGroup
+}
+
+type amqpExchange struct {
+	name string
+	kind ExchangeKind
+}
+
+type amqpQueue struct {
+	exchange  string
+	queueName string
+	key       string
+	queueType SimpleQueueType
+}
+
+type amqpDelayQueue struct {
+	queueName string
+	target    string
+	delay     time.Duration
+	queueType SimpleQueueType
+}
+
+type amqpConsumer struct {
+	ctx       context.Context
+	exchange  string
+	queueName string
+	key       string
+	queueType SimpleQueueType
+	prefetch  int
+	msgs      chan Message
+	pumps     sync.WaitGroup
+}
+
+type amqpPublish struct {
+	exchange string
+	key      string
+	msg      Message
+}
+
+func DialAMQP(url string, opts ...DialOption) (*AMQPBroker, error) {
+	o := newDialOptions(opts)
+	b := &AMQPBroker{
+		url:    url,
+		logger: o.logger,
+		done:   make(chan struct{}),
+	}
+	uri, err := amqp.ParseURI(url)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse RabbitMQ URL: %v", err)
+	}
+	b.user = uri.Username
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to RabbitMQ: %v", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.setup(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// setup makes conn the live connection, restoring all known exchanges and
+// consumers on it. It must be called with b.mu held.
+func (b *AMQPBroker) setup(conn *amqp.Connection) error {
+	// Registered before anything else: on a connection that has already
+	// closed NotifyClose closes the channel without an error, and watch
+	// would never reconnect. If conn closes after this, setup fails below
+	// or watch sees the error.
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	pubCh, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("could not create channel: %v", err)
+	}
+	for _, ex := range b.exchanges {
+		if err := declareExchange(conn, ex.name, ex.kind); err != nil {
+			return err
+		}
+	}
+	for _, q := range b.queues {
+		if err := declareQueue(conn, q); err != nil {
+			return err
+		}
+	}
+	for _, q := range b.delayQueues {
+		if err := declareDelayQueue(conn, q); err != nil {
+			return err
+		}
+	}
+	for _, c := range b.consumers {
+		if err := b.start(conn, c); err != nil {
+			return err
+		}
+	}
+
+	b.conn = conn
+	b.pubCh = pubCh
+	b.connected = true
+	if b.ready != nil {
+		close(b.ready)
+		b.ready = nil
+	}
+	go b.watch(closed)
+
+	pending := b.pending
+	b.pending = nil
+	for i, p := range pending {
+		if err := b.publish(context.Background(), p.exchange, p.key, p.msg); err != nil {
+			b.logger.Error("could not flush buffered publish", "exchange", p.exchange, "routing_key", p.key, "error", err)
+			if b.bufferable(err) {
+				b.pending = append(b.pending, pending[i:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (b *AMQPBroker) watch(closed <-chan *amqp.Error) {
+	amqpErr, ok := <-closed
+	if !ok || amqpErr == nil {
+		return
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.connected = false
+	b.ready = make(chan struct{})
+	b.mu.Unlock()
+	b.logger.Warn("lost connection to RabbitMQ", "error", amqpErr)
+
+	backoff := reconnectMinBackoff
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		conn, err := amqp.Dial(b.url)
+		if err == nil {
+			b.mu.Lock()
+			if b.closed {
+				b.mu.Unlock()
+				conn.Close()
+				return
+			}
+			err = b.setup(conn)
+			b.mu.Unlock()
+			if err == nil {
+				b.logger.Info("reconnected to RabbitMQ")
+				return
+			}
+			conn.Close()
+		}
+		b.logger.Warn("could not reconnect to RabbitMQ", "retry_in", backoff, "error", err)
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+func (b *AMQPBroker) Publish(ctx context.Context, exchange, key string, msg Message) error {
+	if msg.Confirm {
+		return b.publishConfirmed(ctx, exchange, key, msg)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	if b.connected {
+		err := b.publish(ctx, exchange, key, msg)
+		if !b.bufferable(err) {
+			return err
+		}
+	}
+	if len(b.pending) >= publishBufferSize {
+		return ErrPublishBufferFull
+	}
+	b.pending = append(b.pending, amqpPublish{exchange: exchange, key: key, msg: msg})
+	return nil
+}
+
+// publish must be called with b.mu held while connected.
+func (b *AMQPBroker) publish(ctx context.Context, exchange, key string, msg Message) error {
+	if b.pubCh.IsClosed() {
+		// A channel-level error, such as publishing to a missing exchange,
+		// closes the channel but leaves the connection usable.
+		pubCh, err := b.conn.Channel()
+		if err != nil {
+			return fmt.Errorf("could not create channel: %v", err)
+		}
+		b.pubCh = pubCh
+	}
+	return b.pubCh.PublishWithContext(ctx, exchange, key, false, false, b.toPublishing(msg))
+}
+
+// publishConfirmed waits out any outage instead of buffering, since the
+// caller wants to know the message was accepted.
+func (b *AMQPBroker) publishConfirmed(ctx context.Context, exchange, key string, msg Message) error {
+	conn, err := b.waitConnected(ctx)
+	if err != nil {
+		return err
+	}
+
+	b.confirmMu.Lock()
+	defer b.confirmMu.Unlock()
+	if b.confirmCh == nil || b.confirmCh.IsClosed() || b.confirmConn != conn {
+		ch, err := conn.Channel()
+		if err != nil {
+			return fmt.Errorf("could not create channel: %v", err)
+		}
+		if err := ch.Confirm(false); err != nil {
+			ch.Close()
+			return fmt.Errorf("could not put channel in confirm mode: %v", err)
+		}
+		b.confirmConn = conn
+		b.confirmCh = ch
+		b.returns = ch.NotifyReturn(make(chan amqp.Return, 1))
+	}
+
+	dc, err := b.confirmCh.PublishWithDeferredConfirmWithContext(ctx, exchange, key, true, false, b.toPublishing(msg))
+	if err != nil {
+		return err
+	}
+	acked, err := dc.WaitContext(ctx)
+	if err != nil {
+		// Drop the channel so a late ack or return can't be mistaken for
+		// the next message's.
+		b.confirmCh.Close()
+		b.confirmCh = nil
+		return fmt.Errorf("publish was not confirmed: %w", err)
+	}
+	select {
+	case ret, ok := <-b.returns:
+		if ok {
+			return &UnroutableError{
+				Exchange:   ret.Exchange,
+				RoutingKey: ret.RoutingKey,
+				Code:       ret.ReplyCode,
+				Reason:     ret.ReplyText,
+			}
+		}
+	default:
+	}
+	if !acked {
+		return ErrNacked
+	}
+	return nil
+}
+
+// directReplyTo is RabbitMQ's pseudo-queue for replies straight to the
+// channel that published the request.
+const directReplyTo = "amq.rabbitmq.reply-to"
+
+// Request publishes msg on a channel of its own that consumes directReplyTo,
+// so that replies need no queue to be declared. The channel is in confirm
+// mode so that an unroutable request is reported straight away.
+func (b *AMQPBroker) Request(ctx context.Context, exchange, key string, msg Message) (<-chan Message, error) {
+	conn, err := b.waitConnected(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("could not create channel: %v", err)
+	}
+	deliveries, err := ch.Consume(directReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("could not consume replies: %v", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("could not put channel in confirm mode: %v", err)
+	}
+	returns := ch.NotifyReturn(make(chan amqp.Return, 1))
+
+	msg.ReplyTo = directReplyTo
+	dc, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, true, false, b.toPublishing(msg))
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	if _, err := dc.WaitContext(ctx); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("request was not confirmed: %w", err)
+	}
+	select {
+	case ret := <-returns:
+		ch.Close()
+		return nil, &UnroutableError{
+			Exchange:   ret.Exchange,
+			RoutingKey: ret.RoutingKey,
+			Code:       ret.ReplyCode,
+			Reason:     ret.ReplyText,
+		}
+	default:
+	}
+
+	replies := make(chan Message)
+	go func() {
+		defer close(replies)
+		defer ch.Close()
+		for {
+			select {
+			case d, ok := <-deliveries:
+				if !ok {
+					return
+				}
+				reply := fromDelivery(d, nil)
+				reply.acker = nil
+				select {
+				case replies <- reply:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			}
+		}
+	}()
+	return replies, nil
+}
+
+func (b *AMQPBroker) waitConnected(ctx context.Context) (*amqp.Connection, error) {
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return nil, ErrBrokerClosed
+		}
+		if b.connected {
+			conn := b.conn
+			b.mu.Unlock()
+			return conn, nil
+		}
+		ready := b.ready
+		b.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-b.done:
+			return nil, ErrBrokerClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// toPublishing converts msg, with the broker's login as the user-id, which
+// RabbitMQ checks against the connection.
+func (b *AMQPBroker) toPublishing(msg Message) amqp.Publishing {
+	headers := toTable(msg.Headers)
+	if msg.Sender != "" || msg.SchemaVersion != 0 {
+		if headers == nil {
+			headers = amqp.Table{}
+		}
+		if msg.Sender != "" {
+			headers[HeaderSender] = msg.Sender
+		}
+		if msg.SchemaVersion != 0 {
+			headers[HeaderSchemaVersion] = int32(msg.SchemaVersion)
+		}
+	}
+	return amqp.Publishing{
+		ReplyTo:       msg.ReplyTo,
+		ContentType:   msg.ContentType,
+		Headers:       headers,
+		Body:          msg.Body,
+		MessageId:     msg.MessageID,
+		CorrelationId: msg.CorrelationID,
+		Timestamp:     msg.Timestamp,
+		Type:          msg.Type,
+		AppId:         msg.AppID,
+		UserId:        b.user,
+	}
+}
+
+// bufferable reports whether a failed publish should be kept for after the
+// reconnect rather than returned to the caller.
+func (b *AMQPBroker) bufferable(err error) bool {
+	return errors.Is(err, amqp.ErrClosed) && b.conn.IsClosed()
+}
+
+func (b *AMQPBroker) Consume(ctx context.Context, exchange, queueName, key string, queueType SimpleQueueType, prefetch int) (<-chan Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+
+	c := &amqpConsumer{
+		ctx:       ctx,
+		exchange:  exchange,
+		queueName: queueName,
+		key:       key,
+		queueType: queueType,
+		prefetch:  prefetch,
+		msgs:      make(chan Message),
+	}
+	if b.connected {
+		if err := b.start(b.conn, c); err != nil {
+			return nil, err
+		}
+	}
+	b.consumers = append(b.consumers, c)
+
+	b.lifecycles.Add(1)
+	go func() {
+		defer b.lifecycles.Done()
+		select {
+		case <-ctx.Done():
+		case <-b.done:
+		}
+		b.mu.Lock()
+		b.consumers = slices.DeleteFunc(b.consumers, func(other *amqpConsumer) bool {
+			return other == c
+		})
+		b.mu.Unlock()
+		c.pumps.Wait()
+		close(c.msgs)
+	}()
+	return c.msgs, nil
+}
+
+// start declares c's queue on conn and pumps its deliveries into c.msgs until
+// the channel closes or c is cancelled. It must be called with b.mu held.
+func (b *AMQPBroker) start(conn *amqp.Connection, c *amqpConsumer) error {
+	ch, queue, err := DeclareAndBind(conn, c.exchange, c.queueName, c.key, c.queueType)
+	if err != nil {
+		return fmt.Errorf("could not declare and bind queue: %v", err)
+	}
+
+	err = ch.Qos(c.prefetch, 0, false)
+	if err != nil {
+		ch.Close()
+		return err
+	}
+
+	deliveries, err := ch.Consume(
+		queue.Name, // queue
+		"",         // consumer
+		false,      // auto-ack
+		false,      // exclusive
+		false,      // no-local
+		false,      // no-wait
+		nil,        // args
+	)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("could not consume messages: %v", err)
+	}
+
+	c.pumps.Add(1)
+	go func() {
+		defer c.pumps.Done()
+		inflight := &sync.WaitGroup{}
+		for {
+			select {
+			case d, ok := <-deliveries:
+				if !ok {
+					ch.Close()
+					if !conn.IsClosed() && c.ctx.Err() == nil {
+						go b.restart(conn, c)
+					}
+					return
+				}
+				inflight.Add(1)
+				select {
+				case c.msgs <- fromDelivery(d, inflight):
+					continue
+				case <-c.ctx.Done():
+					inflight.Done()
+				}
+			case <-c.ctx.Done():
+			}
+
+			// Let handlers settle what they were given before closing the
+			// channel; anything still buffered is requeued by the close.
+			inflight.Wait()
+			ch.Close()
+			return
+		}
+	}()
+	return nil
+}
+
+// restart resubscribes a consumer whose channel was closed by the broker while
+// the connection stayed up, e.g. because its queue was deleted.
+func (b *AMQPBroker) restart(conn *amqp.Connection, c *amqpConsumer) {
+	backoff := reconnectMinBackoff
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		b.mu.Lock()
+		if b.closed || b.conn != conn || conn.IsClosed() || c.ctx.Err() != nil {
+			// The reconnect loop owns the consumer from here.
+			b.mu.Unlock()
+			return
+		}
+		err := b.start(conn, c)
+		b.mu.Unlock()
+		if err == nil {
+			return
+		}
+		b.logger.Warn("could not resubscribe", "queue", c.queueName, "retry_in", backoff, "error", err)
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+func (b *AMQPBroker) DeclareExchange(name string, kind ExchangeKind) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	ex := amqpExchange{name: name, kind: kind}
+	if slices.Contains(b.exchanges, ex) {
+		return nil
+	}
+	if b.connected {
+		if err := declareExchange(b.conn, name, kind); err != nil {
+			return err
+		}
+	}
+	b.exchanges = append(b.exchanges, ex)
+	return nil
+}
+
+func (b *AMQPBroker) DeclareQueue(exchange, queueName, key string, queueType SimpleQueueType) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	q := amqpQueue{exchange: exchange, queueName: queueName, key: key, queueType: queueType}
+	if slices.Contains(b.queues, q) {
+		return nil
+	}
+	if b.connected {
+		if err := declareQueue(b.conn, q); err != nil {
+			return err
+		}
+	}
+	b.queues = append(b.queues, q)
+	return nil
+}
+
+func declareQueue(conn *amqp.Connection, q amqpQueue) error {
+	ch, _, err := DeclareAndBind(conn, q.exchange, q.queueName, q.key, q.queueType)
+	if err != nil {
+		return err
+	}
+	return ch.Close()
+}
+
+func (b *AMQPBroker) DeclareDelayQueue(queueName, target string, delay time.Duration, queueType SimpleQueueType) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	q := amqpDelayQueue{queueName: queueName, target: target, delay: delay, queueType: queueType}
+	if slices.Contains(b.delayQueues, q) {
+		// Already declared, and re-declared on every reconnect.
+		return nil
+	}
+	if b.connected {
+		if err := declareDelayQueue(b.conn, q); err != nil {
+			return err
+		}
+	}
+	b.delayQueues = append(b.delayQueues, q)
+	return nil
+}
+
+// declareDelayQueue declares a queue without consumers whose messages expire
+// after q.delay and are then dead-lettered, through the default exchange,
+// straight into q.target.
+func declareDelayQueue(conn *amqp.Connection, q amqpDelayQueue) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("could not create channel: %v", err)
+	}
+	defer ch.Close()
+	_, err = ch.QueueDeclare(
+		q.queueName,                       // name
+		q.queueType == SimpleQueueDurable, // durable
+		false,                             // delete when unused
+		q.queueType != SimpleQueueDurable, // exclusive
+		false,                             // no-wait
+		amqp.Table{
+			"x-message-ttl":             q.delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": q.target,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not declare queue: %v", err)
+	}
+	return nil
+}
+
+func queueArgs(exchange string) amqp.Table {
+	if exchange == DeadLetterExchange {
+		// A dead-letter queue must not dead-letter into itself.
+		return nil
+	}
+	return amqp.Table{
+		"x-dead-letter-exchange": DeadLetterExchange,
+	}
+}
+
+func (b *AMQPBroker) Get(queueName string) (Message, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return Message{}, false, ErrBrokerClosed
+	}
+	if !b.connected {
+		return Message{}, false, errors.New("not connected to RabbitMQ")
+	}
+	// Messages fetched here stay unacked on this channel until settled, so
+	// it is kept open across calls.
+	if b.inspectCh == nil || b.inspectCh.IsClosed() {
+		ch, err := b.conn.Channel()
+		if err != nil {
+			return Message{}, false, fmt.Errorf("could not create channel: %v", err)
+		}
+		b.inspectCh = ch
+	}
+	d, ok, err := b.inspectCh.Get(queueName, false)
+	if err != nil || !ok {
+		return Message{}, ok, err
+	}
+	inflight := &sync.WaitGroup{}
+	inflight.Add(1)
+	return fromDelivery(d, inflight), true, nil
+}
+
+func (b *AMQPBroker) Purge(queueName string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, ErrBrokerClosed
+	}
+	if !b.connected {
+		return 0, errors.New("not connected to RabbitMQ")
+	}
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("could not create channel: %v", err)
+	}
+	defer ch.Close()
+	return ch.QueuePurge(queueName, false)
+}
+
+// InspectExchange checks the exchange exists with a passive declare, then
+// redeclares it as DeclareExchange would; RabbitMQ refuses the redeclare
+// if the settings differ and it is a no-op otherwise.
+func (b *AMQPBroker) InspectExchange(name string, kind ExchangeKind) error {
+	return b.inspect(func(ch *amqp.Channel) error {
+		return ch.ExchangeDeclarePassive(name, string(kind), true, false, false, false, nil)
+	}, func(ch *amqp.Channel) error {
+		return ch.ExchangeDeclare(name, string(kind), true, false, false, false, nil)
+	})
+}
+
+func (b *AMQPBroker) InspectQueue(exchange, queueName string, queueType SimpleQueueType) error {
+	durable := queueType == SimpleQueueDurable
+	return b.inspect(func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclarePassive(queueName, durable, !durable, !durable, false, queueArgs(exchange))
+		return err
+	}, func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclare(queueName, durable, !durable, !durable, false, queueArgs(exchange))
+		return err
+	})
+}
+
+// InspectBinding is unsupported: AMQP has no way to list bindings.
+func (b *AMQPBroker) InspectBinding(exchange, queueName, key string) error {
+	return errors.ErrUnsupported
+}
+
+// inspect runs each check on a channel of its own, since a failed declare
+// closes the channel.
+func (b *AMQPBroker) inspect(exists, matches func(*amqp.Channel) error) error {
+	b.mu.Lock()
+	conn, connected := b.conn, b.connected
+	b.mu.Unlock()
+	if !connected {
+		return errors.New("not connected to RabbitMQ")
+	}
+
+	for i, check := range []func(*amqp.Channel) error{exists, matches} {
+		ch, err := conn.Channel()
+		if err != nil {
+			return fmt.Errorf("could not create channel: %v", err)
+		}
+		err = check(ch)
+		ch.Close()
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) {
+			switch {
+			case i == 0 && amqpErr.Code == amqp.NotFound:
+				return ErrNotDeclared
+			case i == 1 && amqpErr.Code == amqp.PreconditionFailed:
+				return fmt.Errorf("%w: %s", ErrMismatch, amqpErr.Reason)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func declareExchange(conn *amqp.Connection, name string, kind ExchangeKind) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("could not create channel: %v", err)
+	}
+	defer ch.Close()
+	err = ch.ExchangeDeclare(name, string(kind), true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("could not declare exchange %s: %v", name, err)
+	}
+	return nil
+}
+
+func (b *AMQPBroker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	var err error
+	if b.inspectCh != nil {
+		b.inspectCh.Close()
+	}
+	if b.connected {
+		err = b.conn.Close()
+	}
+	if len(b.pending) > 0 {
+		b.logger.Warn("dropping buffered publishes", "count", len(b.pending))
+	}
+	b.mu.Unlock()
+
+	b.lifecycles.Wait()
+	return err
+}
+
+type amqpAcker struct {
+	d        amqp.Delivery
+	once     sync.Once
+	inflight *sync.WaitGroup
+}
+
+func (a *amqpAcker) ack() error {
+	defer a.once.Do(a.inflight.Done)
+	return a.d.Ack(false)
+}
+
+func (a *amqpAcker) nack(requeue bool) error {
+	defer a.once.Do(a.inflight.Done)
+	return a.d.Nack(false, requeue)
+}
+
+func fromDelivery(d amqp.Delivery, inflight *sync.WaitGroup) Message {
+	headers := fromTable(d.Headers)
+	env := Envelope{
+		MessageID:     d.MessageId,
+		CorrelationID: d.CorrelationId,
+		Timestamp:     d.Timestamp,
+		Type:          d.Type,
+		AppID:         d.AppId,
+		UserID:        d.UserId,
+	}
+	env.Sender, _ = headers[HeaderSender].(string)
+	switch v := headers[HeaderSchemaVersion].(type) {
+	case int32:
+		env.SchemaVersion = int(v)
+	case int64:
+		env.SchemaVersion = int(v)
+	}
+	delete(headers, HeaderSender)
+	delete(headers, HeaderSchemaVersion)
+	return Message{
+		Envelope:    env,
+		Exchange:    d.Exchange,
+		RoutingKey:  d.RoutingKey,
+		ReplyTo:     d.ReplyTo,
+		ContentType: d.ContentType,
+		Headers:     headers,
+		Body:        d.Body,
+		Redelivered: d.Redelivered,
+		DeliveryTag: d.DeliveryTag,
+		acker:       &amqpAcker{d: d, inflight: inflight},
+	}
+}
+
+func DeclareAndBind(
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType SimpleQueueType,
+) (*amqp.Channel, amqp.Queue, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, amqp.Queue{}, fmt.Errorf("could not create channel: %v", err)
+	}
+
+	queue, err := ch.QueueDeclare(
+		queueName,                             // name
+		simpleQueueType == SimpleQueueDurable, // durable
+		simpleQueueType != SimpleQueueDurable, // delete when unused
+		simpleQueueType != SimpleQueueDurable, // exclusive
+		false,                                 // no-wait
+		queueArgs(exchange),
+	)
+	if err != nil {
+		ch.Close()
+		return nil, amqp.Queue{}, fmt.Errorf("could not declare queue: %v", err)
+	}
+
+	err = ch.QueueBind(
+		queue.Name, // queue name
+		key,        // routing key
+		exchange,   // exchange
+		false,      // no-wait
+		nil,        // args
+	)
+	if err != nil {
+		ch.Close()
+		return nil, amqp.Queue{}, fmt.Errorf("could not bind queue: %v", err)
+	}
+	return ch, queue, nil
+}
+
+// fromTable and toTable convert between amqp.Table, which the client library
+// needs all the way down, and plain maps so Message stays broker-neutral.
+func fromTable(t amqp.Table) map[string]any {
+	if t == nil {
+		return nil
+	}
+	m := make(map[string]any, len(t))
+	for k, v := range t {
+		m[k] = fromTableValue(v)
+	}
+	return m
+}
+
+func fromTableValue(v any) any {
+	switch v := v.(type) {
+	case amqp.Table:
+		return fromTable(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = fromTableValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+func toTable(m map[string]any) amqp.Table {
+	if m == nil {
+		return nil
+	}
+	t := make(amqp.Table, len(m))
+	for k, v := range m {
+		t[k] = toTableValue(v)
+	}
+	return t
+}
+
+func toTableValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return toTable(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = toTableValue(e)
+		}
+		return out
+	}
+	return v
+}
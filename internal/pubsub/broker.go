@@ -0,0 +1,111 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type ExchangeKind string
+
+const (
+	ExchangeDirect ExchangeKind = "direct"
+	ExchangeTopic  ExchangeKind = "topic"
+	ExchangeFanout ExchangeKind = "fanout"
+)
+
+const DeadLetterExchange = "peril_dlx"
+
+// Message is a broker-neutral message, used both for publishing and for
+// deliveries handed out by a Subscriber.
+type Message struct {
+	Envelope
+
+	Exchange   string
+	RoutingKey string
+	// ReplyTo names the queue a reply should be published to through the
+	// default exchange, see Call and Serve.
+	ReplyTo     string
+	ContentType string
+	Headers     map[string]any
+	Body        []byte
+	Redelivered bool
+	DeliveryTag uint64
+
+	// Confirm makes a publish mandatory and waits for the broker to confirm
+	// it, see WithConfirm.
+	Confirm bool
+
+	acker acknowledger
+}
+
+type acknowledger interface {
+	ack() error
+	nack(requeue bool) error
+}
+
+func (m Message) Ack() error {
+	if m.acker == nil {
+		return fmt.Errorf("message was not delivered by a broker")
+	}
+	return m.acker.ack()
+}
+
+func (m Message) Nack(requeue bool) error {
+	if m.acker == nil {
+		return fmt.Errorf("message was not delivered by a broker")
+	}
+	return m.acker.nack(requeue)
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, exchange, key string, msg Message) error
+}
+
+// Requester publishes a request and hands back the replies to it until ctx
+// is done. Replies are already acked. Requests nobody is bound to receive
+// fail with *UnroutableError.
+type Requester interface {
+	Request(ctx context.Context, exchange, key string, msg Message) (<-chan Message, error)
+}
+
+// Subscriber declares a queue, binds it to exchange with key and returns a
+// channel of deliveries that must each be acked or nacked. At most prefetch
+// deliveries are outstanding at a time, 0 meaning no limit. The channel is
+// closed once ctx is cancelled or the broker goes away; deliveries that were
+// not handed out yet are requeued.
+type Subscriber interface {
+	Consume(ctx context.Context, exchange, queueName, key string, queueType SimpleQueueType, prefetch int) (<-chan Message, error)
+}
+
+type Broker interface {
+	Publisher
+	Subscriber
+	Requester
+	DeclareExchange(name string, kind ExchangeKind) error
+	DeclareQueue(exchange, queueName, key string, queueType SimpleQueueType) error
+	// DeclareDelayQueue declares a queue that holds each message for delay
+	// and then moves it to the queue named target.
+	DeclareDelayQueue(queueName, target string, delay time.Duration, queueType SimpleQueueType) error
+	// Get takes the next message off queueName without consuming from it.
+	// ok is false when the queue is empty. The message must be acked or
+	// nacked like any other delivery.
+	Get(queueName string) (msg Message, ok bool, err error)
+	Purge(queueName string) (int, error)
+	Close() error
+}
+
+const (
+	BackendAMQP   = "amqp"
+	BackendMemory = "memory"
+)
+
+func Dial(backend, url string, opts ...DialOption) (Broker, error) {
+	switch backend {
+	case BackendAMQP:
+		return DialAMQP(url, opts...)
+	case BackendMemory:
+		return NewMemoryBroker(), nil
+	}
+	return nil, fmt.Errorf("unknown broker backend: %s", backend)
+}
@@ -0,0 +1,107 @@
+package pubsub
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Codec turns values into message bodies and back. ContentType is stamped on
+// published messages and used by subscribers to pick the decoder.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	JSON Codec = jsonCodec{}
+	Gob  Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                { return "application/json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string { return "application/gob" }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// NewCodec builds a Codec from a marshaller pair, e.g. for MessagePack, CBOR
+// or protobuf:
+//
+//	pubsub.RegisterCodec(pubsub.NewCodec("application/msgpack", msgpack.Marshal, msgpack.Unmarshal))
+func NewCodec(contentType string, marshal func(any) ([]byte, error), unmarshal func([]byte, any) error) Codec {
+	return funcCodec{contentType: contentType, marshal: marshal, unmarshal: unmarshal}
+}
+
+type funcCodec struct {
+	contentType string
+	marshal     func(any) ([]byte, error)
+	unmarshal   func([]byte, any) error
+}
+
+func (c funcCodec) ContentType() string                { return c.contentType }
+func (c funcCodec) Marshal(v any) ([]byte, error)      { return c.marshal(v) }
+func (c funcCodec) Unmarshal(data []byte, v any) error { return c.unmarshal(data, v) }
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		JSON.ContentType(): JSON,
+		Gob.ContentType():  Gob,
+	}
+)
+
+// RegisterCodec makes c available to subscribers receiving messages with its
+// content type, replacing any codec already registered for it.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[mediaType(c.ContentType())] = c
+}
+
+func LookupCodec(contentType string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[mediaType(contentType)]
+	return c, ok
+}
+
+// codecFor picks the decoder for msg, falling back to def for messages
+// published without a content type.
+func codecFor(msg Message, def Codec) (Codec, error) {
+	if msg.ContentType == "" {
+		return def, nil
+	}
+	if mediaType(msg.ContentType) == mediaType(def.ContentType()) {
+		return def, nil
+	}
+	c, ok := LookupCodec(msg.ContentType)
+	if !ok {
+		return nil, fmt.Errorf("no codec registered for content type %s", msg.ContentType)
+	}
+	return c, nil
+}
+
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
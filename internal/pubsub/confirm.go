@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const DefaultConfirmTimeout = 5 * time.Second
+
+var ErrNacked = errors.New("broker nacked the message")
+
+// UnroutableError is returned by a confirmed publish that the exchange could
+// not route to any queue.
+type UnroutableError struct {
+	Exchange   string
+	RoutingKey string
+	Code       uint16
+	Reason     string
+}
+
+func (e *UnroutableError) Error() string {
+	return fmt.Sprintf("message to %s with key %s was returned: %d %s", e.Exchange, e.RoutingKey, e.Code, e.Reason)
+}
+
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	confirm       bool
+	timeout       time.Duration
+	correlationID string
+	schemaVersion int
+	logger        *slog.Logger
+	// reply marks an RPC reply, whose routing key is the caller's own
+	// reply-to address.
+	reply bool
+}
+
+func newPublishOptions(opts []PublishOption) publishOptions {
+	o := publishOptions{schemaVersion: DefaultSchemaVersion, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithConfirm publishes the message as mandatory and waits up to timeout for
+// the broker to confirm it. Unroutable messages fail with *UnroutableError.
+// The default is fire-and-forget.
+func WithConfirm(timeout time.Duration) PublishOption {
+	return func(o *publishOptions) {
+		o.confirm = true
+		o.timeout = timeout
+	}
+}
+
+func publish(pub Publisher, exchange, key string, msg Message, o publishOptions) error {
+	ctx := context.Background()
+	if o.confirm {
+		msg.Confirm = true
+		if o.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, o.timeout)
+			defer cancel()
+		}
+	}
+	err := pub.Publish(ctx, exchange, key, msg)
+	// Reply-to addresses are unique to each request, so they would add a
+	// series per call.
+	metricKey := key
+	if o.reply {
+		metricKey = "reply"
+	}
+	publishedTotal.With(exchange, metricKey, publishOutcome(err)).Inc()
+	logger := o.logger.With("exchange", exchange, "routing_key", key, "content_type", msg.ContentType, "message_id", msg.MessageID, "confirm", o.confirm)
+	if err != nil {
+		logger.Debug("could not publish message", "error", err)
+		return err
+	}
+	logger.Debug("published message")
+	return nil
+}
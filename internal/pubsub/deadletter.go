@@ -0,0 +1,68 @@
+package pubsub
+
+// DeadLetter describes why and from where a message reached the dead-letter
+// exchange, read from RabbitMQ's x-death header or, for undecodable messages,
+// from the headers added by DecodeErrorDeadLetter.
+type DeadLetter struct {
+	Reason     string
+	Queue      string
+	Exchange   string
+	RoutingKey string
+	Count      int64
+}
+
+func DeadLetterInfo(msg Message) (DeadLetter, bool) {
+	if decodeErr, ok := msg.Headers[HeaderDecodeError].(string); ok {
+		dl := DeadLetter{Reason: "decode error: " + decodeErr, Count: 1}
+		dl.Queue, _ = msg.Headers[HeaderDecodeQueue].(string)
+		dl.Exchange, _ = msg.Headers[HeaderOriginalExchange].(string)
+		dl.RoutingKey, _ = msg.Headers[HeaderOriginalKey].(string)
+		return dl, true
+	}
+
+	deaths, _ := msg.Headers["x-death"].([]any)
+	if len(deaths) == 0 {
+		return DeadLetter{}, false
+	}
+	// RabbitMQ keeps the most recent death first.
+	death, ok := deaths[0].(map[string]any)
+	if !ok {
+		return DeadLetter{}, false
+	}
+	dl := DeadLetter{}
+	dl.Reason, _ = death["reason"].(string)
+	dl.Queue, _ = death["queue"].(string)
+	dl.Exchange, _ = death["exchange"].(string)
+	dl.Count, _ = death["count"].(int64)
+	if keys, ok := death["routing-keys"].([]any); ok && len(keys) > 0 {
+		dl.RoutingKey, _ = keys[0].(string)
+	}
+	if ex, ok := msg.Headers[HeaderOriginalExchange].(string); ok && dl.Exchange == "" {
+		// Retried messages reach their queue through the default exchange.
+		dl.Exchange = ex
+		dl.RoutingKey, _ = msg.Headers[HeaderOriginalKey].(string)
+	}
+	return dl, true
+}
+
+// Revived returns a copy of msg without dead-letter bookkeeping, ready to be
+// republished to its original exchange.
+func Revived(msg Message) Message {
+	headers := map[string]any{}
+	for k, v := range msg.Headers {
+		switch k {
+		case "x-death", "x-first-death-exchange", "x-first-death-queue", "x-first-death-reason",
+			"x-last-death-exchange", "x-last-death-queue", "x-last-death-reason",
+			HeaderDecodeError, HeaderDecodeQueue, HeaderOriginalExchange, HeaderOriginalKey, HeaderFailedAt,
+			HeaderRetryCount:
+			continue
+		}
+		headers[k] = v
+	}
+	return Message{
+		Envelope:    msg.Envelope,
+		ContentType: msg.ContentType,
+		Headers:     headers,
+		Body:        msg.Body,
+	}
+}
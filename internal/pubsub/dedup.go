@@ -0,0 +1,216 @@
+package pubsub
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DedupStore remembers the IDs of messages that have been handled so that
+// redeliveries can be skipped.
+type DedupStore interface {
+	Seen(id string) (bool, error)
+	Mark(id string) error
+}
+
+// WithDedup acks deliveries whose MessageID is already in store without
+// handing them to the handler. IDs are recorded once the handler acks.
+// Workers of one subscription never handle the same ID at once; stores
+// shared between subscriptions or processes get no such guarantee.
+func WithDedup(store DedupStore) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.dedup = store
+	}
+}
+
+// claims holds the message IDs being handled, so that checking, handling
+// and marking an ID happen as one step.
+type claims struct {
+	mu  sync.Mutex
+	ids map[string]chan struct{}
+}
+
+// claim waits until no other worker holds id, then holds it until release
+// is called.
+func (c *claims) claim(id string) (release func()) {
+	for {
+		c.mu.Lock()
+		held, ok := c.ids[id]
+		if !ok {
+			done := make(chan struct{})
+			c.ids[id] = done
+			c.mu.Unlock()
+			return func() {
+				c.mu.Lock()
+				delete(c.ids, id)
+				c.mu.Unlock()
+				close(done)
+			}
+		}
+		c.mu.Unlock()
+		<-held
+	}
+}
+
+// MemoryDedupStore keeps the most recently handled IDs, forgetting the least
+// recently seen ones past its capacity.
+type MemoryDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	ids      map[string]*list.Element
+}
+
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		ids:      map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryDedupStore) Seen(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.ids[id]
+	if ok {
+		s.order.MoveToFront(e)
+	}
+	return ok, nil
+}
+
+func (s *MemoryDedupStore) Mark(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mark(id)
+	return nil
+}
+
+func (s *MemoryDedupStore) mark(id string) {
+	if e, ok := s.ids[id]; ok {
+		s.order.MoveToFront(e)
+		return
+	}
+	s.ids[id] = s.order.PushFront(id)
+	if s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.ids, oldest.Value.(string))
+	}
+}
+
+// list returns the remembered IDs, oldest first.
+func (s *MemoryDedupStore) list() []string {
+	ids := make([]string, 0, s.order.Len())
+	for e := s.order.Back(); e != nil; e = e.Prev() {
+		ids = append(ids, e.Value.(string))
+	}
+	return ids
+}
+
+// FileDedupStore is a MemoryDedupStore that survives restarts by appending
+// IDs to a file, one per line. The file is rewritten with only the
+// remembered IDs once it grows to twice the capacity.
+type FileDedupStore struct {
+	mem   *MemoryDedupStore
+	path  string
+	f     *os.File
+	lines int
+}
+
+func OpenFileDedupStore(path string, capacity int) (*FileDedupStore, error) {
+	s := &FileDedupStore{mem: NewMemoryDedupStore(capacity), path: path}
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not open dedup file: %v", err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if id := scanner.Text(); id != "" {
+				s.mem.mark(id)
+				s.lines++
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("could not read dedup file: %v", err)
+		}
+	}
+
+	s.f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open dedup file: %v", err)
+	}
+	return s, nil
+}
+
+func (s *FileDedupStore) Seen(id string) (bool, error) {
+	return s.mem.Seen(id)
+}
+
+func (s *FileDedupStore) Mark(id string) error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	if s.f == nil {
+		return fmt.Errorf("dedup store %s is closed", s.path)
+	}
+	if _, ok := s.mem.ids[id]; ok {
+		return nil
+	}
+	s.mem.mark(id)
+	if _, err := fmt.Fprintln(s.f, id); err != nil {
+		return fmt.Errorf("could not write dedup file: %v", err)
+	}
+	s.lines++
+	if s.lines >= 2*s.mem.capacity {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact must be called with s.mem.mu held.
+func (s *FileDedupStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not compact dedup file: %v", err)
+	}
+	ids := s.mem.list()
+	w := bufio.NewWriter(tmp)
+	for _, id := range ids {
+		fmt.Fprintln(w, id)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not compact dedup file: %v", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not compact dedup file: %v", err)
+	}
+
+	s.f.Close()
+	s.f, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		s.f = nil
+		return fmt.Errorf("could not reopen dedup file: %v", err)
+	}
+	s.lines = len(ids)
+	return nil
+}
+
+func (s *FileDedupStore) Close() error {
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
@@ -0,0 +1,95 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupConcurrentRedelivery(t *testing.T) {
+	b := newTestBroker(t)
+	var handled atomic.Int32
+	sub, err := SubscribeJSON(context.Background(), b, "ex", "q", "key", SimpleQueueDurable, func(string) Acktype {
+		handled.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return Ack
+	}, WithConcurrency(4), WithPrefetch(4), WithDedup(NewMemoryDedupStore(10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		msg := Message{Envelope: Envelope{MessageID: "once"}, ContentType: JSON.ContentType(), Body: []byte(`"hi"`)}
+		if err := b.Publish(context.Background(), "ex", "key", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	sub.Close()
+	if n := handled.Load(); n != 1 {
+		t.Errorf("message handled %d times, want once", n)
+	}
+	if queued := drain(t, b, "q"); len(queued) != 0 {
+		t.Errorf("%d duplicate(s) left unacked", len(queued))
+	}
+}
+
+func TestMemoryDedupStoreCapacity(t *testing.T) {
+	s := NewMemoryDedupStore(2)
+	s.Mark("a")
+	s.Mark("b")
+	s.Seen("a") // a is now more recent than b
+	s.Mark("c")
+	for id, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if seen, _ := s.Seen(id); seen != want {
+			t.Errorf("Seen(%s) = %t, want %t", id, seen, want)
+		}
+	}
+}
+
+func TestFileDedupStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup")
+	s, err := OpenFileDedupStore(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Six marks reach twice the capacity and compact the file to the last
+	// three.
+	for i := range 6 {
+		if err := s.Mark(fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(data)); fmt.Sprint(got) != "[3 4 5]" {
+		t.Errorf("compacted file has %v, want [3 4 5]", got)
+	}
+	// Marks after compacting are appended to the new file.
+	if err := s.Mark("6"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Mark("7"); err == nil {
+		t.Error("Mark on a closed store succeeded")
+	}
+
+	s, err = OpenFileDedupStore(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for id, want := range map[string]bool{"3": false, "4": true, "5": true, "6": true, "2": false, "7": false} {
+		if seen, _ := s.Seen(id); seen != want {
+			t.Errorf("after reopening, Seen(%s) = %t, want %t", id, seen, want)
+		}
+	}
+}
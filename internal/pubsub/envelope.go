@@ -0,0 +1,117 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	HeaderSender        = "x-sender"
+	HeaderSchemaVersion = "x-schema-version"
+)
+
+// DefaultSchemaVersion is stamped on messages published without
+// WithSchemaVersion.
+const DefaultSchemaVersion = 1
+
+// Envelope is the metadata Publish stamps on every message.
+type Envelope struct {
+	MessageID     string
+	CorrelationID string
+	Timestamp     time.Time
+	// Type is the Go type of the payload, e.g. "gamelogic.SpawnCommand".
+	Type  string
+	AppID string
+	// Sender is who the publisher says it is; see AsSender.
+	Sender string
+	// UserID is who the broker logged the publisher in as. Only the AMQP
+	// broker sets it, and RabbitMQ rejects publishes that claim another.
+	UserID        string
+	SchemaVersion int
+}
+
+// Delivery is a decoded message along with its envelope.
+type Delivery[T any] struct {
+	Envelope
+	Exchange    string
+	RoutingKey  string
+	ReplyTo     string
+	Headers     map[string]any
+	Redelivered bool
+	Payload     T
+}
+
+var appID = filepath.Base(os.Args[0])
+
+func newMessageID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func newEnvelope(val any, o publishOptions) Envelope {
+	return Envelope{
+		MessageID:     newMessageID(),
+		CorrelationID: o.correlationID,
+		Timestamp:     time.Now().UTC(),
+		Type:          fmt.Sprintf("%T", val),
+		AppID:         appID,
+		SchemaVersion: o.schemaVersion,
+	}
+}
+
+// WithCorrelationID links the message to another one, typically the
+// MessageID of the delivery that caused it to be published.
+func WithCorrelationID(id string) PublishOption {
+	return func(o *publishOptions) {
+		o.correlationID = id
+	}
+}
+
+func WithSchemaVersion(v int) PublishOption {
+	return func(o *publishOptions) {
+		o.schemaVersion = v
+	}
+}
+
+type senderPublisher struct {
+	Publisher
+	sender string
+}
+
+// AsSender stamps sender on every message published through pub that
+// doesn't already carry one.
+func AsSender(pub Publisher, sender string) Publisher {
+	return senderPublisher{Publisher: pub, sender: sender}
+}
+
+func (p senderPublisher) Publish(ctx context.Context, exchange, key string, msg Message) error {
+	if msg.Sender == "" {
+		msg.Sender = p.sender
+	}
+	return p.Publisher.Publish(ctx, exchange, key, msg)
+}
+
+type senderRequester struct {
+	Requester
+	sender string
+}
+
+// RequestAsSender stamps sender on every request made through r that
+// doesn't already carry one, as AsSender does for publishes.
+func RequestAsSender(r Requester, sender string) Requester {
+	return senderRequester{Requester: r, sender: sender}
+}
+
+func (r senderRequester) Request(ctx context.Context, exchange, key string, msg Message) (<-chan Message, error) {
+	if msg.Sender == "" {
+		msg.Sender = r.sender
+	}
+	return r.Requester.Request(ctx, exchange, key, msg)
+}
@@ -0,0 +1,33 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestAsSender(t *testing.T) {
+	b := newTestBroker(t)
+	ctx := context.Background()
+	_, err := Serve(ctx, b, "ex", "q", "key", SimpleQueueDurable, JSON, func(_ context.Context, d Delivery[string]) (string, error) {
+		return d.Sender, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		requester Requester
+		want      string
+	}{
+		{b, ""},
+		{RequestAsSender(b, "alice"), "alice"},
+	}
+	for _, tt := range tests {
+		got, err := Call[string, string](ctx, tt.requester, JSON, "ex", "key", "hi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("sender = %q, want %q", got, tt.want)
+		}
+	}
+}
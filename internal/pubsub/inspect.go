@@ -0,0 +1,18 @@
+package pubsub
+
+import "errors"
+
+var (
+	ErrNotDeclared = errors.New("not declared")
+	ErrMismatch    = errors.New("declared with different settings")
+)
+
+// Inspector checks what a broker has declared without changing it. Checks
+// a backend can't make return errors.ErrUnsupported.
+type Inspector interface {
+	InspectExchange(name string, kind ExchangeKind) error
+	// InspectQueue checks a queue as DeclareQueue would declare it when
+	// binding it to exchange.
+	InspectQueue(exchange, queueName string, queueType SimpleQueueType) error
+	InspectBinding(exchange, queueName, key string) error
+}
@@ -0,0 +1,64 @@
+package pubsub
+
+import "log/slog"
+
+func (a Acktype) String() string {
+	switch a {
+	case Ack:
+		return "ack"
+	case NackDiscard:
+		return "nack_discard"
+	case NackRequeue:
+		return "nack_requeue"
+	case NackRetry:
+		return "nack_retry"
+	}
+	return "unknown"
+}
+
+func WithLogger(logger *slog.Logger) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.logger = logger
+	}
+}
+
+type DialOption func(*dialOptions)
+
+type dialOptions struct {
+	logger *slog.Logger
+}
+
+func newDialOptions(opts []DialOption) dialOptions {
+	o := dialOptions{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func WithBrokerLogger(logger *slog.Logger) DialOption {
+	return func(o *dialOptions) {
+		o.logger = logger
+	}
+}
+
+// WithPublishLogger logs publishes, and replies CallAll skips, to logger
+// rather than slog.Default().
+func WithPublishLogger(logger *slog.Logger) PublishOption {
+	return func(o *publishOptions) {
+		o.logger = logger
+	}
+}
+
+func messageLogger(logger *slog.Logger, queueName string, msg Message) *slog.Logger {
+	return logger.With(
+		"exchange", msg.Exchange,
+		"queue", queueName,
+		"routing_key", msg.RoutingKey,
+		"content_type", msg.ContentType,
+		"delivery_tag", msg.DeliveryTag,
+		"message_id", msg.MessageID,
+		"type", msg.Type,
+		"sender", msg.Sender,
+	)
+}
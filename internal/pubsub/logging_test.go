@@ -0,0 +1,20 @@
+package pubsub
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestWithPublishLogger(t *testing.T) {
+	b := newTestBroker(t)
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if err := PublishJSON(b, "ex", "key", "hi", WithPublishLogger(logger)); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "published message") || !strings.Contains(got, "routing_key=key") {
+		t.Errorf("log = %q, want the publish", got)
+	}
+}
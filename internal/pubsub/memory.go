@@ -0,0 +1,577 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrBrokerClosed = errors.New("broker is closed")
+
+// MemoryBroker is an in-process Broker with RabbitMQ-like semantics: direct,
+// topic and fanout exchanges, durable and transient queues, prefetch,
+// ack/nack/requeue and dead-lettering. It is meant for tests and for running
+// a single process without a RabbitMQ server.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	exchanges map[string]*memExchange
+	queues    map[string]*memQueue
+	closed    bool
+	tags      uint64
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+type memExchange struct {
+	kind     ExchangeKind
+	bindings []memBinding
+}
+
+type memBinding struct {
+	queue string
+	key   string
+}
+
+type memQueue struct {
+	name    string
+	durable bool
+	// deadLetter is only used when hasDeadLetter is set, since "" is the
+	// default exchange. deadLetterKey overrides the routing key if set.
+	hasDeadLetter bool
+	deadLetter    string
+	deadLetterKey string
+	ttl           time.Duration
+	ready         []Message
+	consumers     int
+	cond          *sync.Cond
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		exchanges: map[string]*memExchange{},
+		queues:    map[string]*memQueue{},
+		done:      make(chan struct{}),
+	}
+}
+
+func (b *MemoryBroker) DeclareExchange(name string, kind ExchangeKind) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	if ex, ok := b.exchanges[name]; ok {
+		if ex.kind != kind {
+			return fmt.Errorf("exchange %s already declared as %s", name, ex.kind)
+		}
+		return nil
+	}
+	b.exchanges[name] = &memExchange{kind: kind}
+	return nil
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, exchange, key string, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	routed, err := b.route(exchange, key, msg)
+	if err != nil {
+		return err
+	}
+	if msg.Confirm && routed == 0 {
+		return &UnroutableError{Exchange: exchange, RoutingKey: key, Code: 312, Reason: "NO_ROUTE"}
+	}
+	return nil
+}
+
+// route delivers msg to every matching queue and reports how many there
+// were. It must be called with b.mu held.
+func (b *MemoryBroker) route(exchange, key string, msg Message) (int, error) {
+	msg.Exchange = exchange
+	msg.RoutingKey = key
+	msg.Redelivered = false
+	msg.Confirm = false
+	msg.acker = nil
+
+	if exchange == "" {
+		if q, ok := b.queues[key]; ok {
+			b.push(q, msg)
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return 0, fmt.Errorf("no exchange '%s'", exchange)
+	}
+	routed := map[string]struct{}{}
+	for _, bnd := range ex.bindings {
+		if _, ok := routed[bnd.queue]; ok {
+			continue
+		}
+		if !ex.matches(bnd.key, key) {
+			continue
+		}
+		if q, ok := b.queues[bnd.queue]; ok {
+			routed[bnd.queue] = struct{}{}
+			b.push(q, msg)
+		}
+	}
+	return len(routed), nil
+}
+
+func (ex *memExchange) matches(pattern, key string) bool {
+	return MatchRoutingKey(ex.kind, pattern, key)
+}
+
+// MatchRoutingKey reports whether an exchange of the given kind routes a
+// message with key to a queue bound with pattern.
+func MatchRoutingKey(kind ExchangeKind, pattern, key string) bool {
+	switch kind {
+	case ExchangeFanout:
+		return true
+	case ExchangeTopic:
+		return matchTopic(strings.Split(pattern, "."), strings.Split(key, "."))
+	}
+	return pattern == key
+}
+
+// matchTopic implements AMQP topic matching, where "*" matches exactly one
+// word and "#" matches zero or more words.
+func matchTopic(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchTopic(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchTopic(pattern[1:], words[1:])
+	}
+	return len(words) > 0 && pattern[0] == words[0] && matchTopic(pattern[1:], words[1:])
+}
+
+func (b *MemoryBroker) Consume(ctx context.Context, exchange, queueName, key string, queueType SimpleQueueType, prefetch int) (<-chan Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+
+	q, err := b.declareQueue(exchange, queueName, key, queueType)
+	if err != nil {
+		return nil, err
+	}
+	if !q.durable && q.consumers > 0 {
+		return nil, fmt.Errorf("could not consume messages: %s is exclusive", queueName)
+	}
+
+	q.consumers++
+	msgs := make(chan Message)
+	b.wg.Add(1)
+	go b.deliver(ctx, q, &memConsumer{prefetch: prefetch}, msgs)
+	return msgs, nil
+}
+
+// Request delivers replies through a private transient queue that is
+// deleted once ctx is done, like RabbitMQ's direct reply-to.
+func (b *MemoryBroker) Request(ctx context.Context, exchange, key string, msg Message) (<-chan Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+
+	b.tags++
+	q := &memQueue{
+		name: fmt.Sprintf("amq.rabbitmq.reply-to.%d", b.tags),
+		cond: sync.NewCond(&b.mu),
+	}
+	msg.ReplyTo = q.name
+	routed, err := b.route(exchange, key, msg)
+	if err != nil {
+		return nil, err
+	}
+	if routed == 0 {
+		return nil, &UnroutableError{Exchange: exchange, RoutingKey: key, Code: 312, Reason: "NO_ROUTE"}
+	}
+	b.queues[q.name] = q
+	q.consumers++
+
+	msgs := make(chan Message)
+	b.wg.Add(1)
+	go b.deliver(ctx, q, &memConsumer{}, msgs)
+
+	replies := make(chan Message)
+	go func() {
+		defer close(replies)
+		for msg := range msgs {
+			msg.Ack()
+			msg.acker = nil
+			select {
+			case replies <- msg:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return replies, nil
+}
+
+func (b *MemoryBroker) DeclareQueue(exchange, queueName, key string, queueType SimpleQueueType) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	_, err := b.declareQueue(exchange, queueName, key, queueType)
+	return err
+}
+
+// declareQueue must be called with b.mu held.
+func (b *MemoryBroker) declareQueue(exchange, queueName, key string, queueType SimpleQueueType) (*memQueue, error) {
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return nil, fmt.Errorf("could not bind queue: no exchange '%s'", exchange)
+	}
+
+	q, ok := b.queues[queueName]
+	if ok {
+		if q.durable != (queueType == SimpleQueueDurable) {
+			return nil, fmt.Errorf("could not declare queue: %s already declared with different durability", queueName)
+		}
+	} else {
+		q = &memQueue{
+			name:    queueName,
+			durable: queueType == SimpleQueueDurable,
+			cond:    sync.NewCond(&b.mu),
+		}
+		if exchange != DeadLetterExchange {
+			q.hasDeadLetter = true
+			q.deadLetter = DeadLetterExchange
+		}
+		b.queues[queueName] = q
+	}
+
+	bound := false
+	for _, bnd := range ex.bindings {
+		if bnd.queue == queueName && bnd.key == key {
+			bound = true
+			break
+		}
+	}
+	if !bound {
+		ex.bindings = append(ex.bindings, memBinding{queue: queueName, key: key})
+	}
+	return q, nil
+}
+
+func (b *MemoryBroker) InspectExchange(name string, kind ExchangeKind) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ex, ok := b.exchanges[name]
+	if !ok {
+		return ErrNotDeclared
+	}
+	if ex.kind != kind {
+		return fmt.Errorf("%w: exchange is %s", ErrMismatch, ex.kind)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) InspectQueue(exchange, queueName string, queueType SimpleQueueType) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.queues[queueName]
+	if !ok {
+		return ErrNotDeclared
+	}
+	if q.durable != (queueType == SimpleQueueDurable) {
+		return fmt.Errorf("%w: durable is %t", ErrMismatch, q.durable)
+	}
+	if q.hasDeadLetter != (exchange != DeadLetterExchange) {
+		return fmt.Errorf("%w: dead-lettering is %t", ErrMismatch, q.hasDeadLetter)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) InspectBinding(exchange, queueName, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return ErrNotDeclared
+	}
+	for _, bnd := range ex.bindings {
+		if bnd.queue == queueName && bnd.key == key {
+			return nil
+		}
+	}
+	return ErrNotDeclared
+}
+
+func (b *MemoryBroker) Get(queueName string) (Message, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return Message{}, false, ErrBrokerClosed
+	}
+	q, ok := b.queues[queueName]
+	if !ok {
+		return Message{}, false, fmt.Errorf("no queue '%s'", queueName)
+	}
+	if len(q.ready) == 0 {
+		return Message{}, false, nil
+	}
+	msg := q.ready[0]
+	q.ready = q.ready[1:]
+	b.tags++
+	msg.DeliveryTag = b.tags
+	msg.acker = &memAcker{broker: b, queue: q, msg: msg}
+	return msg, true, nil
+}
+
+func (b *MemoryBroker) Purge(queueName string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, ErrBrokerClosed
+	}
+	q, ok := b.queues[queueName]
+	if !ok {
+		return 0, fmt.Errorf("no queue '%s'", queueName)
+	}
+	n := len(q.ready)
+	q.ready = nil
+	return n, nil
+}
+
+type memConsumer struct {
+	prefetch int
+	unacked  int
+}
+
+func (c *memConsumer) full() bool {
+	return c.prefetch > 0 && c.unacked >= c.prefetch
+}
+
+func (b *MemoryBroker) deliver(ctx context.Context, q *memQueue, c *memConsumer, msgs chan<- Message) {
+	defer b.wg.Done()
+	defer close(msgs)
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		q.cond.Broadcast()
+	})
+	defer stop()
+
+	for {
+		b.mu.Lock()
+		for !b.closed && ctx.Err() == nil && (len(q.ready) == 0 || c.full()) {
+			q.cond.Wait()
+		}
+		if b.closed || ctx.Err() != nil {
+			b.release(q)
+			b.mu.Unlock()
+			return
+		}
+		msg := q.ready[0]
+		q.ready = q.ready[1:]
+		c.unacked++
+		b.tags++
+		msg.DeliveryTag = b.tags
+		msg.acker = &memAcker{broker: b, queue: q, consumer: c, msg: msg}
+		b.mu.Unlock()
+
+		select {
+		case msgs <- msg:
+			continue
+		case <-ctx.Done():
+		case <-b.done:
+		}
+		// Nobody took msg, so it goes back to the front of the queue.
+		b.mu.Lock()
+		if msg.acker.(*memAcker).claim() {
+			c.unacked--
+			q.ready = append([]Message{msg}, q.ready...)
+		}
+		b.release(q)
+		b.mu.Unlock()
+		return
+	}
+}
+
+// release drops a consumer from q, deleting the queue and its bindings once
+// a transient queue has no consumers left. It must be called with b.mu held.
+func (b *MemoryBroker) release(q *memQueue) {
+	q.consumers--
+	if q.durable || q.consumers > 0 {
+		return
+	}
+	delete(b.queues, q.name)
+	for _, ex := range b.exchanges {
+		bindings := ex.bindings[:0]
+		for _, bnd := range ex.bindings {
+			if bnd.queue != q.name {
+				bindings = append(bindings, bnd)
+			}
+		}
+		ex.bindings = bindings
+	}
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	for _, q := range b.queues {
+		q.cond.Broadcast()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+	return nil
+}
+
+// push must be called with b.mu held.
+func (b *MemoryBroker) push(q *memQueue, msg Message) {
+	q.ready = append(q.ready, msg)
+	q.cond.Signal()
+	if q.ttl > 0 {
+		time.AfterFunc(q.ttl, func() {
+			b.expire(q)
+		})
+	}
+}
+
+// expire dead-letters the message at the head of q. Like RabbitMQ, messages
+// only expire from the head, and since every message in a queue shares its
+// TTL the head is always the oldest one.
+func (b *MemoryBroker) expire(q *memQueue) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || len(q.ready) == 0 {
+		return
+	}
+	msg := q.ready[0]
+	q.ready = q.ready[1:]
+	b.deadLetter(q, msg, "expired")
+}
+
+func (b *MemoryBroker) DeclareDelayQueue(queueName, target string, delay time.Duration, queueType SimpleQueueType) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	if q, ok := b.queues[queueName]; ok {
+		if q.ttl != delay || q.deadLetterKey != target {
+			return fmt.Errorf("could not declare queue: %s already declared with different arguments", queueName)
+		}
+		return nil
+	}
+	b.queues[queueName] = &memQueue{
+		name:          queueName,
+		durable:       queueType == SimpleQueueDurable,
+		hasDeadLetter: true,
+		deadLetterKey: target,
+		ttl:           delay,
+		cond:          sync.NewCond(&b.mu),
+	}
+	return nil
+}
+
+type memAcker struct {
+	broker   *MemoryBroker
+	queue    *memQueue
+	consumer *memConsumer
+	msg      Message
+	settled  bool
+}
+
+// claim marks the message settled, reporting whether it wasn't already. It
+// must be called with the broker's mutex held.
+func (a *memAcker) claim() bool {
+	if a.settled {
+		return false
+	}
+	a.settled = true
+	return true
+}
+
+func (a *memAcker) settle(fn func()) error {
+	a.broker.mu.Lock()
+	defer a.broker.mu.Unlock()
+	if !a.claim() {
+		return errors.New("message already acknowledged")
+	}
+	if a.consumer != nil {
+		a.consumer.unacked--
+	}
+	fn()
+	a.queue.cond.Broadcast()
+	return nil
+}
+
+func (a *memAcker) ack() error {
+	return a.settle(func() {})
+}
+
+func (a *memAcker) nack(requeue bool) error {
+	return a.settle(func() {
+		if requeue {
+			msg := a.msg
+			msg.acker = nil
+			msg.Redelivered = true
+			a.queue.ready = append([]Message{msg}, a.queue.ready...)
+			return
+		}
+		a.broker.deadLetter(a.queue, a.msg, "rejected")
+	})
+}
+
+// deadLetter republishes msg to the queue's dead-letter exchange with an
+// x-death header like RabbitMQ's. It must be called with b.mu held.
+func (b *MemoryBroker) deadLetter(q *memQueue, msg Message, reason string) {
+	if !q.hasDeadLetter || b.closed {
+		return
+	}
+	headers := make(map[string]any, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	death := map[string]any{
+		"reason":       reason,
+		"queue":        q.name,
+		"exchange":     msg.Exchange,
+		"routing-keys": []any{msg.RoutingKey},
+		"count":        int64(1),
+	}
+	deaths, _ := headers["x-death"].([]any)
+	headers["x-death"] = append([]any{death}, deaths...)
+	msg.Headers = headers
+	key := msg.RoutingKey
+	if q.deadLetterKey != "" {
+		key = q.deadLetterKey
+	}
+	b.route(q.deadLetter, key, msg)
+}
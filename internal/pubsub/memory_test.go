@@ -0,0 +1,207 @@
+package pubsub
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"a.b", "a.b", true},
+		{"a.b", "a.c", false},
+		{"a.b", "a.b.c", false},
+		{"a.*", "a.b", true},
+		{"a.*", "a", false},
+		{"a.*", "a.b.c", false},
+		{"*.b.*", "a.b.c", true},
+		{"a.#", "a", true},
+		{"a.#", "a.b", true},
+		{"a.#", "a.b.c", true},
+		{"a.#", "b.a", false},
+		{"#", "", true},
+		{"#", "a.b.c", true},
+		{"#.c", "a.b.c", true},
+		{"#.c", "a.b", false},
+		{"a.#.c", "a.c", true},
+		{"a.#.c", "a.b.b.c", true},
+		{"a.*.#", "a", false},
+		{"a.*.#", "a.b", true},
+	}
+	for _, tt := range tests {
+		got := matchTopic(strings.Split(tt.pattern, "."), strings.Split(tt.key, "."))
+		if got != tt.want {
+			t.Errorf("matchTopic(%q, %q) = %t, want %t", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+// newTestBroker returns a broker with a direct exchange "ex" routing "key"
+// to the durable queue "q", and a dead-letter queue "dlq".
+func newTestBroker(t *testing.T) *MemoryBroker {
+	t.Helper()
+	b := NewMemoryBroker()
+	t.Cleanup(func() { b.Close() })
+	for _, err := range []error{
+		b.DeclareExchange("ex", ExchangeDirect),
+		b.DeclareExchange(DeadLetterExchange, ExchangeFanout),
+		b.DeclareQueue("ex", "q", "key", SimpleQueueDurable),
+		b.DeclareQueue(DeadLetterExchange, "dlq", "", SimpleQueueDurable),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func TestMemoryBrokerSettle(t *testing.T) {
+	tests := []struct {
+		name            string
+		settle          func(Message) error
+		wantQueue       int
+		wantDeadLetters int
+	}{
+		{"ack", Message.Ack, 0, 0},
+		{"requeue", func(m Message) error { return m.Nack(true) }, 1, 0},
+		{"dead-letter", func(m Message) error { return m.Nack(false) }, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBroker(t)
+			if err := b.Publish(context.Background(), "ex", "key", Message{Body: []byte("hi")}); err != nil {
+				t.Fatal(err)
+			}
+			msg, ok, err := b.Get("q")
+			if err != nil || !ok {
+				t.Fatalf("Get(q) = %t, %v", ok, err)
+			}
+			if err := tt.settle(msg); err != nil {
+				t.Fatal(err)
+			}
+			if err := msg.Ack(); err == nil {
+				t.Error("settling a message twice succeeded")
+			}
+
+			queued := drain(t, b, "q")
+			if len(queued) != tt.wantQueue {
+				t.Fatalf("q has %d message(s), want %d", len(queued), tt.wantQueue)
+			}
+			for _, m := range queued {
+				if !m.Redelivered {
+					t.Error("requeued message is not marked redelivered")
+				}
+			}
+			dead := drain(t, b, "dlq")
+			if len(dead) != tt.wantDeadLetters {
+				t.Fatalf("dlq has %d message(s), want %d", len(dead), tt.wantDeadLetters)
+			}
+			for _, m := range dead {
+				deaths, _ := m.Headers["x-death"].([]any)
+				if len(deaths) != 1 || deaths[0].(map[string]any)["reason"] != "rejected" {
+					t.Errorf("x-death = %v, want one rejection", m.Headers["x-death"])
+				}
+				if string(m.Body) != "hi" {
+					t.Errorf("dead letter body = %q", m.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerPrefetch(t *testing.T) {
+	tests := []struct {
+		prefetch int
+		// want is how many messages arrive before any are acked.
+		want int
+	}{
+		{prefetch: 0, want: 3},
+		{prefetch: 1, want: 1},
+		{prefetch: 2, want: 2},
+	}
+	for _, tt := range tests {
+		b := newTestBroker(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		msgs, err := b.Consume(ctx, "ex", "q", "key", SimpleQueueDurable, tt.prefetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 3 {
+			if err := b.Publish(ctx, "ex", "key", Message{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got := []Message{}
+	receive:
+		for {
+			select {
+			case m := <-msgs:
+				got = append(got, m)
+			case <-time.After(50 * time.Millisecond):
+				break receive
+			}
+		}
+		if len(got) != tt.want {
+			t.Errorf("prefetch %d: got %d message(s) before acking, want %d", tt.prefetch, len(got), tt.want)
+			continue
+		}
+		if tt.want < 3 {
+			got[0].Ack()
+			select {
+			case <-msgs:
+			case <-time.After(time.Second):
+				t.Errorf("prefetch %d: no message after acking", tt.prefetch)
+			}
+		}
+	}
+}
+
+func drain(t *testing.T, b *MemoryBroker, queueName string) []Message {
+	t.Helper()
+	msgs := []Message{}
+	for {
+		msg, ok, err := b.Get(queueName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return msgs
+		}
+		msg.Ack()
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestMemoryBrokerCancelDuringDelivery(t *testing.T) {
+	for i := range 20 {
+		b := newTestBroker(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		msgs, err := b.Consume(ctx, "ex", "q", "key", SimpleQueueDurable, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Publish(context.Background(), "ex", "key", Message{}); err != nil {
+			t.Fatal(err)
+		}
+		// Let the broker block sending, then cancel as soon as the
+		// message is taken.
+		time.Sleep(time.Millisecond)
+		msg := <-msgs
+		cancel()
+		for range msgs {
+		}
+		if err := msg.Ack(); err != nil {
+			t.Fatalf("run %d: could not ack a delivered message: %v", i, err)
+		}
+		if queued := drain(t, b, "q"); len(queued) != 0 {
+			t.Fatalf("run %d: a delivered message was requeued", i)
+		}
+	}
+}
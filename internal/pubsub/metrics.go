@@ -0,0 +1,49 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+
+	"github.com/thrashdev/bootdev-peril/internal/metrics"
+)
+
+var (
+	publishedTotal = metrics.NewCounterVec(
+		"peril_pubsub_published_total",
+		"Messages published, by exchange, routing key and outcome.",
+		"exchange", "routing_key", "outcome",
+	)
+	consumedTotal = metrics.NewCounterVec(
+		"peril_pubsub_consumed_total",
+		"Messages consumed, by exchange, routing key, queue and how they were settled.",
+		"exchange", "routing_key", "queue", "outcome",
+	)
+	handlerDuration = metrics.NewHistogramVec(
+		"peril_pubsub_handler_duration_seconds",
+		"Time spent decoding and handling a message.",
+		metrics.DefBuckets,
+		"queue",
+	)
+	inflightMessages = metrics.NewGaugeVec(
+		"peril_pubsub_inflight_messages",
+		"Messages currently being handled.",
+		"queue",
+	)
+)
+
+func publishOutcome(err error) string {
+	var unroutable *UnroutableError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &unroutable):
+		return "unroutable"
+	case errors.Is(err, ErrNacked):
+		return "nacked"
+	case errors.Is(err, ErrPublishBufferFull):
+		return "buffer_full"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "error"
+}
@@ -0,0 +1,63 @@
+package pubsub
+
+import "log/slog"
+
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	decodeErrorPolicy DecodeErrorPolicy
+	retry             RetryPolicy
+	prefetch          int
+	concurrency       int
+	orderKey          func(Message) string
+	logger            *slog.Logger
+	dedup             DedupStore
+}
+
+func newSubscribeOptions(opts []SubscribeOption) subscribeOptions {
+	o := subscribeOptions{
+		decodeErrorPolicy: DecodeErrorDeadLetter,
+		retry:             DefaultRetryPolicy,
+		prefetch:          defaultPrefetch,
+		concurrency:       1,
+		logger:            slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func WithDecodeErrorPolicy(policy DecodeErrorPolicy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.decodeErrorPolicy = policy
+	}
+}
+
+// WithPrefetch limits how many unacked messages the broker hands this
+// subscription at once. 0 means no limit.
+func WithPrefetch(n int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.prefetch = n
+	}
+}
+
+// WithConcurrency runs the handler on n workers. Prefetch should be at least
+// n for all of them to be kept busy.
+func WithConcurrency(n int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.concurrency = max(n, 1)
+	}
+}
+
+// WithOrderingKey makes messages that share a key be handled one at a time in
+// the order they arrived, even with several workers.
+func WithOrderingKey(key func(Message) string) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.orderKey = key
+	}
+}
+
+func ByRoutingKey(msg Message) string {
+	return msg.RoutingKey
+}
@@ -0,0 +1,77 @@
+package pubsub
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// DecodeErrorPolicy decides what happens to a message whose body can't be
+// decoded into the subscription's type.
+type DecodeErrorPolicy int
+
+const (
+	// DecodeErrorDeadLetter republishes the message to DeadLetterExchange
+	// with x-decode-error headers describing the failure.
+	DecodeErrorDeadLetter DecodeErrorPolicy = iota
+	// DecodeErrorDiscard acks and drops the message.
+	DecodeErrorDiscard
+	// DecodeErrorRequeue puts the message back on the queue, e.g. while a
+	// consumer that understands it is being rolled out.
+	DecodeErrorRequeue
+)
+
+const (
+	HeaderDecodeError      = "x-decode-error"
+	HeaderDecodeQueue      = "x-decode-queue"
+	HeaderOriginalExchange = "x-original-exchange"
+	HeaderOriginalKey      = "x-original-routing-key"
+	HeaderFailedAt         = "x-failed-at"
+)
+
+func handleDecodeError(logger *slog.Logger, sub Subscriber, queueName string, policy DecodeErrorPolicy, msg Message, decodeErr error) {
+	switch policy {
+	case DecodeErrorDiscard:
+		msg.Ack()
+		return
+	case DecodeErrorRequeue:
+		msg.Nack(true)
+		return
+	}
+
+	pub, ok := sub.(Publisher)
+	if !ok {
+		// The broker's own dead-lettering still gets it to the DLX, just
+		// without the error details.
+		msg.Nack(false)
+		return
+	}
+
+	headers := make(map[string]any, len(msg.Headers)+5)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderDecodeError] = decodeErr.Error()
+	headers[HeaderDecodeQueue] = queueName
+	headers[HeaderOriginalExchange] = msg.Exchange
+	headers[HeaderOriginalKey] = msg.RoutingKey
+	headers[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	// The copy is confirmed before the original is acked; a dead-letter
+	// exchange with nothing bound to it would otherwise swallow both.
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConfirmTimeout)
+	defer cancel()
+	err := pub.Publish(ctx, DeadLetterExchange, msg.RoutingKey, Message{
+		Envelope:    msg.Envelope,
+		ContentType: msg.ContentType,
+		Headers:     headers,
+		Body:        msg.Body,
+		Confirm:     true,
+	})
+	if err != nil {
+		logger.Error("could not dead-letter undecodable message", "error", err)
+		msg.Nack(false)
+		return
+	}
+	msg.Ack()
+}
@@ -1,13 +1,8 @@
 package pubsub
 
 import (
-	"bytes"
 	"context"
-	"encoding/gob"
-	"encoding/json"
-	"fmt"
-
-	amqp "github.com/rabbitmq/amqp091-go"
+	"time"
 )
 
 type Acktype int
@@ -23,185 +18,165 @@ const (
 	Ack Acktype = iota
 	NackDiscard
 	NackRequeue
+	// NackRetry redelivers the message later according to the
+	// subscription's RetryPolicy.
+	NackRetry
 )
 
+const defaultPrefetch = 10
+
 func SubscribeJSON[T any](
-	conn *amqp.Connection,
+	ctx context.Context,
+	sub Subscriber,
 	exchange,
 	queueName,
 	key string,
 	simpleQueueType SimpleQueueType,
 	handler func(T) Acktype,
-) error {
-	ch, queue, err := DeclareAndBind(conn, exchange, queueName, key, simpleQueueType)
-	if err != nil {
-		return fmt.Errorf("could not declare and bind queue: %v", err)
-	}
-
-	msgs, err := ch.Consume(
-		queue.Name, // queue
-		"",         // consumer
-		false,      // auto-ack
-		false,      // exclusive
-		false,      // no-local
-		false,      // no-wait
-		nil,        // args
-	)
-	if err != nil {
-		return fmt.Errorf("could not consume messages: %v", err)
-	}
-
-	unmarshaller := func(data []byte) (T, error) {
-		var target T
-		err := json.Unmarshal(data, &target)
-		return target, err
-	}
-
-	go func() {
-		defer ch.Close()
-		for msg := range msgs {
-			target, err := unmarshaller(msg.Body)
-			if err != nil {
-				fmt.Printf("could not unmarshal message: %v\n", err)
-				continue
-			}
-			switch handler(target) {
-			case Ack:
-				msg.Ack(false)
-				fmt.Println("Ack")
-			case NackDiscard:
-				msg.Nack(false, false)
-				fmt.Println("NackDiscard")
-			case NackRequeue:
-				msg.Nack(false, true)
-				fmt.Println("NackRequeue")
-			}
-		}
-	}()
-	return nil
+	opts ...SubscribeOption,
+) (*Subscription, error) {
+	return Subscribe(ctx, sub, exchange, queueName, key, simpleQueueType, JSON, handler, opts...)
 }
 
-func SubscribeGob[T any](conn *amqp.Connection, exchange, queueName, key string, simpleQueueType SimpleQueueType, handler func(T) Acktype) error {
-	ch, queue, err := DeclareAndBind(conn, exchange, queueName, key, simpleQueueType)
-	if err != nil {
-		return fmt.Errorf("could not declare and bind queue: %v", err)
-	}
+func SubscribeGob[T any](ctx context.Context, sub Subscriber, exchange, queueName, key string, simpleQueueType SimpleQueueType, handler func(T) Acktype, opts ...SubscribeOption) (*Subscription, error) {
+	return Subscribe(ctx, sub, exchange, queueName, key, simpleQueueType, Gob, handler, opts...)
+}
 
-	err = ch.Qos(10, 0, true)
-	if err != nil {
-		return err
-	}
+// Subscribe consumes from queueName and hands each decoded message to
+// handler. The decoder is picked from the message's content type, so a queue
+// may carry several formats; codec is used for messages without one.
+func Subscribe[T any](
+	ctx context.Context,
+	sub Subscriber,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType SimpleQueueType,
+	codec Codec,
+	handler func(T) Acktype,
+	opts ...SubscribeOption,
+) (*Subscription, error) {
+	return SubscribeDelivery(ctx, sub, exchange, queueName, key, simpleQueueType, codec, func(d Delivery[T]) Acktype {
+		return handler(d.Payload)
+	}, opts...)
+}
 
-	msgs, err := ch.Consume(
-		queue.Name, // queue
-		"",         // consumer
-		false,      // auto-ack
-		false,      // exclusive
-		false,      // no-local
-		false,      // no-wait
-		nil,        // args
-	)
+// SubscribeDelivery is Subscribe for handlers that also want the message's
+// envelope, e.g. to correlate what they publish with what they received.
+func SubscribeDelivery[T any](
+	ctx context.Context,
+	sub Subscriber,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType SimpleQueueType,
+	codec Codec,
+	handler func(Delivery[T]) Acktype,
+	opts ...SubscribeOption,
+) (*Subscription, error) {
+	o := newSubscribeOptions(opts)
+	ctx, cancel := context.WithCancel(ctx)
+	msgs, err := sub.Consume(ctx, exchange, queueName, key, simpleQueueType, o.prefetch)
 	if err != nil {
-		return fmt.Errorf("could not consume messages: %v", err)
-	}
-
-	unmarshaller := func(data []byte) (T, error) {
-		buf := bytes.NewBuffer(data)
-		dec := gob.NewDecoder(buf)
-		var target T
-		if err := dec.Decode(&target); err != nil {
-			return target, err
-		}
-
-		return target, nil
+		cancel()
+		return nil, err
 	}
 
-	go func() {
-		defer ch.Close()
-		for msg := range msgs {
-			target, err := unmarshaller(msg.Body)
+	s := &Subscription{cancel: cancel, done: make(chan struct{})}
+	inflight := inflightMessages.With(queueName)
+	duration := handlerDuration.With(queueName)
+	held := &claims{ids: map[string]chan struct{}{}}
+	process := func(msg Message) {
+		inflight.Inc()
+		defer inflight.Dec()
+		start := time.Now()
+		defer func() { duration.Observe(time.Since(start).Seconds()) }()
+
+		logger := messageLogger(o.logger, queueName, msg)
+		if o.dedup != nil && msg.MessageID != "" {
+			release := held.claim(msg.MessageID)
+			defer release()
+			seen, err := o.dedup.Seen(msg.MessageID)
 			if err != nil {
-				fmt.Printf("could not unmarshal message: %v\n", err)
-				continue
+				logger.Warn("could not check for duplicate message", "error", err)
+			}
+			if seen {
+				msg.Ack()
+				consumedTotal.With(msg.Exchange, msg.RoutingKey, queueName, "duplicate").Inc()
+				logger.Debug("skipped duplicate message")
+				return
 			}
-			switch handler(target) {
-			case Ack:
-				msg.Ack(false)
-				fmt.Println("Ack")
-			case NackDiscard:
-				msg.Nack(false, false)
-				fmt.Println("NackDiscard")
-			case NackRequeue:
-				msg.Nack(false, true)
-				fmt.Println("NackRequeue")
+		}
+		target, err := decode[T](msg, codec)
+		if err != nil {
+			logger.Warn("could not decode message", "error", err, "policy", o.decodeErrorPolicy)
+			s.decodeErrors.Add(1)
+			consumedTotal.With(msg.Exchange, msg.RoutingKey, queueName, "decode_error").Inc()
+			handleDecodeError(logger, sub, queueName, o.decodeErrorPolicy, msg, err)
+			return
+		}
+		outcome := handler(Delivery[T]{
+			Envelope:    msg.Envelope,
+			Exchange:    msg.Exchange,
+			RoutingKey:  msg.RoutingKey,
+			ReplyTo:     msg.ReplyTo,
+			Headers:     msg.Headers,
+			Redelivered: msg.Redelivered,
+			Payload:     target,
+		})
+		switch outcome {
+		case Ack:
+			msg.Ack()
+			if o.dedup != nil && msg.MessageID != "" {
+				if err := o.dedup.Mark(msg.MessageID); err != nil {
+					logger.Warn("could not record handled message", "error", err)
+				}
 			}
+		case NackDiscard:
+			msg.Nack(false)
+		case NackRequeue:
+			msg.Nack(true)
+		case NackRetry:
+			retry(logger, sub, queueName, simpleQueueType, o.retry, msg)
 		}
+		consumedTotal.With(msg.Exchange, msg.RoutingKey, queueName, outcome.String()).Inc()
+		logger.Debug("handled message", "outcome", outcome)
+	}
+	go func() {
+		defer close(s.done)
+		defer cancel()
+		dispatch(msgs, o.concurrency, o.prefetch, o.orderKey, process)
 	}()
-	return nil
-
+	return s, nil
 }
 
-func DeclareAndBind(
-	conn *amqp.Connection,
-	exchange,
-	queueName,
-	key string,
-	simpleQueueType SimpleQueueType,
-) (*amqp.Channel, amqp.Queue, error) {
-	ch, err := conn.Channel()
+func decode[T any](msg Message, def Codec) (T, error) {
+	var target T
+	codec, err := codecFor(msg, def)
 	if err != nil {
-		return nil, amqp.Queue{}, fmt.Errorf("could not create channel: %v", err)
+		return target, err
 	}
+	err = codec.Unmarshal(msg.Body, &target)
+	return target, err
+}
 
-	queue, err := ch.QueueDeclare(
-		queueName,                             // name
-		simpleQueueType == SimpleQueueDurable, // durable
-		simpleQueueType != SimpleQueueDurable, // delete when unused
-		simpleQueueType != SimpleQueueDurable, // exclusive
-		false,                                 // no-wait
-		amqp.Table{
-			"x-dead-letter-exchange": "peril_dlx",
-		},
-	)
-	if err != nil {
-		return nil, amqp.Queue{}, fmt.Errorf("could not declare queue: %v", err)
-	}
+func PublishJSON[T any](pub Publisher, exchange, key string, val T, opts ...PublishOption) error {
+	return Publish(pub, JSON, exchange, key, val, opts...)
+}
 
-	err = ch.QueueBind(
-		queue.Name, // queue name
-		key,        // routing key
-		exchange,   // exchange
-		false,      // no-wait
-		nil,        // args
-	)
-	if err != nil {
-		return nil, amqp.Queue{}, fmt.Errorf("could not bind queue: %v", err)
-	}
-	return ch, queue, nil
+func PublishGob[T any](pub Publisher, exchange, key string, val T, opts ...PublishOption) error {
+	return Publish(pub, Gob, exchange, key, val, opts...)
 }
 
-func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
-	dat, err := json.Marshal(val)
+func Publish[T any](pub Publisher, codec Codec, exchange, key string, val T, opts ...PublishOption) error {
+	dat, err := codec.Marshal(val)
 	if err != nil {
 		return err
 	}
-	return ch.PublishWithContext(context.Background(), exchange, key, false, false, amqp.Publishing{
-		ContentType: "application/json",
+	o := newPublishOptions(opts)
+	return publish(pub, exchange, key, Message{
+		Envelope:    newEnvelope(val, o),
+		ContentType: codec.ContentType(),
 		Body:        dat,
-	})
-}
-
-func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-
-	if err := enc.Encode(val); err != nil {
-		return err
-	}
-
-	return ch.PublishWithContext(context.Background(), exchange, key, false, false, amqp.Publishing{
-		ContentType: "application/gob",
-		Body:        buf.Bytes(),
-	})
-
+	}, o)
 }
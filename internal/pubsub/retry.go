@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const HeaderRetryCount = "x-retry-count"
+
+// RetryPolicy controls what happens to messages a handler answers with
+// NackRetry. Each retry waits in a delay queue, twice as long as the one
+// before, before going back to the original queue. Once MaxAttempts
+// deliveries have failed the message is dead-lettered.
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  5,
+	InitialDelay: time.Second,
+	MaxDelay:     time.Minute,
+}
+
+func (p RetryPolicy) delay(retries int) time.Duration {
+	d := p.InitialDelay
+	for i := 0; i < retries && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+func WithRetry(policy RetryPolicy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.retry = policy
+	}
+}
+
+type delayer interface {
+	Publisher
+	DeclareDelayQueue(queueName, target string, delay time.Duration, queueType SimpleQueueType) error
+}
+
+func retryCount(msg Message) int {
+	switch n := msg.Headers[HeaderRetryCount].(type) {
+	case int:
+		return n
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	}
+	return 0
+}
+
+// retry schedules msg for another delivery to queueName, or dead-letters it
+// once the policy is exhausted.
+func retry(logger *slog.Logger, sub Subscriber, queueName string, queueType SimpleQueueType, policy RetryPolicy, msg Message) {
+	retries := retryCount(msg)
+	if retries+1 >= policy.MaxAttempts {
+		logger.Warn("giving up on message", "attempts", retries+1)
+		msg.Nack(false)
+		return
+	}
+
+	d, ok := sub.(delayer)
+	if !ok {
+		msg.Nack(true)
+		return
+	}
+
+	delay := policy.delay(retries)
+	delayQueue := fmt.Sprintf("%s.retry.%d", queueName, delay.Milliseconds())
+	err := d.DeclareDelayQueue(delayQueue, queueName, delay, queueType)
+	if err != nil {
+		logger.Error("could not declare retry queue", "retry_queue", delayQueue, "error", err)
+		msg.Nack(true)
+		return
+	}
+
+	headers := make(map[string]any, len(msg.Headers)+3)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderRetryCount] = int64(retries + 1)
+	// The message comes back through the default exchange, so keep where it
+	// was first published for dead-letter inspection and replay.
+	if _, ok := headers[HeaderOriginalExchange]; !ok {
+		headers[HeaderOriginalExchange] = msg.Exchange
+		headers[HeaderOriginalKey] = msg.RoutingKey
+	}
+
+	// Only ack the original once the broker has the copy, or the message
+	// is lost.
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConfirmTimeout)
+	defer cancel()
+	err = d.Publish(ctx, "", delayQueue, Message{
+		Envelope:    msg.Envelope,
+		ContentType: msg.ContentType,
+		Headers:     headers,
+		Body:        msg.Body,
+		Confirm:     true,
+	})
+	if err != nil {
+		logger.Error("could not schedule retry", "retry_queue", delayQueue, "error", err)
+		msg.Nack(true)
+		return
+	}
+	msg.Ack()
+	logger.Info("scheduled retry", "attempt", retries+1, "delay", delay)
+}
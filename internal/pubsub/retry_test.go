@@ -0,0 +1,92 @@
+package pubsub
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	tests := []struct {
+		retries int
+		want    time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+		{2, 40 * time.Millisecond},
+		{3, 50 * time.Millisecond},
+		{10, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := p.delay(tt.retries); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.retries, got, tt.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	b := newTestBroker(t)
+	policy := RetryPolicy{MaxAttempts: 3, InitialDelay: 20 * time.Millisecond, MaxDelay: time.Second}
+
+	type attempt struct {
+		at      time.Time
+		retries int
+	}
+	var mu sync.Mutex
+	attempts := []attempt{}
+	sub, err := SubscribeDelivery(context.Background(), b, "ex", "q", "key", SimpleQueueDurable, JSON, func(d Delivery[string]) Acktype {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, attempt{time.Now(), retryCount(Message{Headers: d.Headers})})
+		return NackRetry
+	}, WithRetry(policy), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if err := PublishJSON(b, "ex", "key", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	var dead []Message
+	for deadline := time.Now().Add(2 * time.Second); len(dead) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		dead = drain(t, b, "dlq")
+	}
+	if len(dead) != 1 {
+		t.Fatalf("%d dead letter(s), want 1", len(dead))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != policy.MaxAttempts {
+		t.Fatalf("handled %d time(s), want %d", len(attempts), policy.MaxAttempts)
+	}
+	for i, a := range attempts {
+		if a.retries != i {
+			t.Errorf("attempt %d has retry count %d", i+1, a.retries)
+		}
+		if i == 0 {
+			continue
+		}
+		if wait, want := a.at.Sub(attempts[i-1].at), policy.delay(i-1); wait < want {
+			t.Errorf("attempt %d came after %s, want at least %s", i+1, wait, want)
+		}
+	}
+
+	dl := dead[0]
+	if got := retryCount(dl); got != policy.MaxAttempts-1 {
+		t.Errorf("dead letter has retry count %d, want %d", got, policy.MaxAttempts-1)
+	}
+	if dl.Headers[HeaderOriginalExchange] != "ex" || dl.Headers[HeaderOriginalKey] != "key" {
+		t.Errorf("dead letter came from %v/%v, want ex/key", dl.Headers[HeaderOriginalExchange], dl.Headers[HeaderOriginalKey])
+	}
+	for _, queue := range []string{"q.retry.20", "q.retry.40"} {
+		if _, _, err := b.Get(queue); err != nil {
+			t.Errorf("retry queue %s: %v", queue, err)
+		}
+	}
+}
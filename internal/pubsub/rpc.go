@@ -0,0 +1,192 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultCallTimeout applies to calls whose context has no deadline.
+const DefaultCallTimeout = 5 * time.Second
+
+const (
+	HeaderRPCError     = "x-rpc-error"
+	HeaderRPCErrorCode = "x-rpc-error-code"
+	// HeaderRPCDeadline tells the server when the caller stops waiting, as
+	// RFC 3339 with nanoseconds.
+	HeaderRPCDeadline = "x-rpc-deadline"
+)
+
+const (
+	RPCErrorInternal   = "internal"
+	RPCErrorBadRequest = "bad_request"
+	RPCErrorNotFound   = "not_found"
+)
+
+// RemoteError is an error returned by a Serve handler and sent back to the
+// caller. Handlers may return one to choose the code; any other error is
+// sent as RPCErrorInternal.
+type RemoteError struct {
+	Code    string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote error (%s): %s", e.Code, e.Message)
+}
+
+// Call publishes req and waits for the first reply to it.
+func Call[Req, Resp any](ctx context.Context, r Requester, codec Codec, exchange, key string, req Req, opts ...PublishOption) (Resp, error) {
+	var resp Resp
+	ctx, cancel := callContext(ctx)
+	defer cancel()
+
+	id, replies, err := request(ctx, r, codec, exchange, key, req, newPublishOptions(opts))
+	if err != nil {
+		return resp, err
+	}
+	for reply := range replies {
+		if reply.CorrelationID != id {
+			continue
+		}
+		d, err := decodeReply[Resp](reply, codec)
+		return d.Payload, err
+	}
+	return resp, fmt.Errorf("no reply from %s/%s: %w", exchange, key, ctx.Err())
+}
+
+// CallAll publishes req and collects every reply that arrives before ctx is
+// done, for requests that several servers answer. Error replies are
+// skipped.
+func CallAll[Req, Resp any](ctx context.Context, r Requester, codec Codec, exchange, key string, req Req, opts ...PublishOption) ([]Delivery[Resp], error) {
+	ctx, cancel := callContext(ctx)
+	defer cancel()
+
+	o := newPublishOptions(opts)
+	id, replies, err := request(ctx, r, codec, exchange, key, req, o)
+	if err != nil {
+		return nil, err
+	}
+	out := []Delivery[Resp]{}
+	for reply := range replies {
+		if reply.CorrelationID != id {
+			continue
+		}
+		d, err := decodeReply[Resp](reply, codec)
+		if err != nil {
+			messageLogger(o.logger, "", reply).Debug("skipped error reply", "error", err)
+			continue
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+func callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, DefaultCallTimeout)
+}
+
+func request[Req any](ctx context.Context, r Requester, codec Codec, exchange, key string, req Req, o publishOptions) (string, <-chan Message, error) {
+	dat, err := codec.Marshal(req)
+	if err != nil {
+		return "", nil, err
+	}
+	msg := Message{
+		Envelope:    newEnvelope(req, o),
+		ContentType: codec.ContentType(),
+		Body:        dat,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Headers = map[string]any{HeaderRPCDeadline: deadline.UTC().Format(time.RFC3339Nano)}
+	}
+	replies, err := r.Request(ctx, exchange, key, msg)
+	publishedTotal.With(exchange, key, publishOutcome(err)).Inc()
+	return msg.MessageID, replies, err
+}
+
+func decodeReply[Resp any](reply Message, def Codec) (Delivery[Resp], error) {
+	d := Delivery[Resp]{
+		Envelope:   reply.Envelope,
+		Exchange:   reply.Exchange,
+		RoutingKey: reply.RoutingKey,
+	}
+	if text, ok := reply.Headers[HeaderRPCError].(string); ok {
+		code, _ := reply.Headers[HeaderRPCErrorCode].(string)
+		return d, &RemoteError{Code: code, Message: text}
+	}
+	payload, err := decode[Resp](reply, def)
+	if err != nil {
+		return d, fmt.Errorf("could not decode reply: %w", err)
+	}
+	d.Payload = payload
+	return d, nil
+}
+
+// Serve answers requests made with Call on queueName. The handler's context
+// is cancelled when the caller stops waiting.
+func Serve[Req, Resp any](
+	ctx context.Context,
+	broker Broker,
+	exchange,
+	queueName,
+	key string,
+	simpleQueueType SimpleQueueType,
+	codec Codec,
+	handler func(context.Context, Delivery[Req]) (Resp, error),
+	opts ...SubscribeOption,
+) (*Subscription, error) {
+	o := newSubscribeOptions(opts)
+	return SubscribeDelivery(ctx, broker, exchange, queueName, key, simpleQueueType, codec, func(d Delivery[Req]) Acktype {
+		logger := o.logger.With("queue", queueName, "message_id", d.MessageID, "reply_to", d.ReplyTo)
+		if d.ReplyTo == "" {
+			logger.Warn("discarding request without a reply-to address")
+			return NackDiscard
+		}
+
+		reqCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		if header, ok := d.Headers[HeaderRPCDeadline].(string); ok {
+			deadline, err := time.Parse(time.RFC3339Nano, header)
+			if err != nil {
+				logger.Warn("discarding request with a bad deadline", "error", err)
+				return NackDiscard
+			}
+			if time.Now().After(deadline) {
+				logger.Debug("dropping request the caller gave up on")
+				return Ack
+			}
+			reqCtx, cancel = context.WithDeadline(reqCtx, deadline)
+			defer cancel()
+		}
+
+		resp, err := handler(reqCtx, d)
+		reply := Message{Envelope: newEnvelope(resp, newPublishOptions(nil))}
+		reply.CorrelationID = d.MessageID
+		if err != nil {
+			var remote *RemoteError
+			if !errors.As(err, &remote) {
+				remote = &RemoteError{Code: RPCErrorInternal, Message: err.Error()}
+			}
+			reply.Type = ""
+			reply.Headers = map[string]any{HeaderRPCError: remote.Message, HeaderRPCErrorCode: remote.Code}
+		} else {
+			reply.ContentType = codec.ContentType()
+			reply.Body, err = codec.Marshal(resp)
+			if err != nil {
+				logger.Error("could not encode reply", "error", err)
+				return NackDiscard
+			}
+		}
+
+		// A reply that can't be delivered means the caller is gone, so
+		// there is nothing to retry.
+		if err := publish(broker, "", d.ReplyTo, reply, publishOptions{logger: logger, reply: true}); err != nil {
+			logger.Warn("could not send reply", "error", err)
+		}
+		return Ack
+	}, opts...)
+}
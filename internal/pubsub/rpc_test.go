@@ -0,0 +1,41 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/thrashdev/bootdev-peril/internal/metrics"
+)
+
+func publishedSeries() int {
+	var buf bytes.Buffer
+	metrics.Default.WriteText(&buf)
+	return strings.Count(buf.String(), "\nperil_pubsub_published_total{")
+}
+
+func TestCallMetricSeries(t *testing.T) {
+	b := newTestBroker(t)
+	ctx := context.Background()
+	_, err := Serve(ctx, b, "ex", "q", "key", SimpleQueueDurable, JSON, func(_ context.Context, d Delivery[int]) (int, error) {
+		return d.Payload, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := func(i int) {
+		t.Helper()
+		if got, err := Call[int, int](ctx, b, JSON, "ex", "key", i); err != nil || got != i {
+			t.Fatalf("Call(%d) = %d, %v", i, got, err)
+		}
+	}
+	call(0)
+	before := publishedSeries()
+	for i := range 50 {
+		call(i)
+	}
+	if after := publishedSeries(); after != before {
+		t.Errorf("published series grew from %d to %d over 50 calls", before, after)
+	}
+}
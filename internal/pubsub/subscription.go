@@ -0,0 +1,42 @@
+package pubsub
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Subscription is a handle on a running consumer started by Subscribe.
+type Subscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	decodeErrors atomic.Uint64
+}
+
+// Close stops the consumer and blocks until the handler has finished with
+// every message it was given.
+func (s *Subscription) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// Wait blocks until the consumer stops, either through Close, through the
+// context passed to Subscribe being cancelled, or the broker closing.
+func (s *Subscription) Wait() {
+	<-s.done
+}
+
+// DecodeErrors reports how many messages this subscription could not decode.
+func (s *Subscription) DecodeErrors() uint64 {
+	return s.decodeErrors.Load()
+}
+
+func CloseAll(subs []*Subscription) {
+	for _, s := range subs {
+		s.cancel()
+	}
+	for _, s := range subs {
+		s.Wait()
+	}
+}
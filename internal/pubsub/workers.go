@@ -0,0 +1,56 @@
+package pubsub
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// dispatch feeds msgs to process on concurrency workers and returns once msgs
+// is closed and every worker is idle. With an orderKey, messages sharing a
+// key always go to the same worker so they are handled in order. Each
+// worker's lane holds up to buffer messages, so one busy key doesn't stall
+// the others while the prefetch window allows more in.
+func dispatch(msgs <-chan Message, concurrency, buffer int, orderKey func(Message) string, process func(Message)) {
+	if concurrency <= 1 {
+		for msg := range msgs {
+			process(msg)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	if orderKey == nil {
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for msg := range msgs {
+					process(msg)
+				}
+			}()
+		}
+		wg.Wait()
+		return
+	}
+
+	lanes := make([]chan Message, concurrency)
+	for i := range lanes {
+		lanes[i] = make(chan Message, buffer)
+		wg.Add(1)
+		go func(lane <-chan Message) {
+			defer wg.Done()
+			for msg := range lane {
+				process(msg)
+			}
+		}(lanes[i])
+	}
+	for msg := range msgs {
+		h := fnv.New32a()
+		h.Write([]byte(orderKey(msg)))
+		lanes[h.Sum32()%uint32(concurrency)] <- msg
+	}
+	for _, lane := range lanes {
+		close(lane)
+	}
+	wg.Wait()
+}
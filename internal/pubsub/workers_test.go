@@ -0,0 +1,64 @@
+package pubsub
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func lane(key string, concurrency int) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % uint32(concurrency)
+}
+
+func TestDispatchBusyKey(t *testing.T) {
+	const concurrency = 2
+	other := "b"
+	for i := 0; lane(other, concurrency) == lane("a", concurrency); i++ {
+		other = fmt.Sprintf("b%d", i)
+	}
+
+	msgs := make(chan Message)
+	block := make(chan struct{})
+	var mu sync.Mutex
+	handled := map[string][]int{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatch(msgs, concurrency, 3, func(m Message) string { return m.RoutingKey }, func(m Message) {
+			if m.RoutingKey == "a" {
+				<-block
+			}
+			mu.Lock()
+			handled[m.RoutingKey] = append(handled[m.RoutingKey], int(m.DeliveryTag))
+			mu.Unlock()
+		})
+	}()
+
+	send := func(msg Message) {
+		t.Helper()
+		select {
+		case msgs <- msg:
+		case <-time.After(time.Second):
+			t.Fatalf("message for %q waited behind a busy key", msg.RoutingKey)
+		}
+	}
+	// The first "a" blocks its worker and the rest wait in its lane.
+	for i := range 3 {
+		send(Message{RoutingKey: "a", DeliveryTag: uint64(i)})
+	}
+	send(Message{RoutingKey: other})
+	close(block)
+	close(msgs)
+	<-done
+
+	if got := handled["a"]; fmt.Sprint(got) != "[0 1 2]" {
+		t.Errorf("messages for a were handled as %v, want in order", got)
+	}
+	if len(handled[other]) != 1 {
+		t.Errorf("%d message(s) for %q were handled, want 1", len(handled[other]), other)
+	}
+}
@@ -1,13 +1,10 @@
 package routing
 
-import "time"
+import "github.com/thrashdev/bootdev-peril/internal/gamelogic"
 
-type PlayingState struct {
-	IsPaused bool
-}
-
-type GameLog struct {
-	CurrentTime time.Time
-	Message     string
-	Username    string
-}
+// The pause and game log payloads live in gamelogic so that topics can be
+// declared here without an import cycle.
+type (
+	PlayingState = gamelogic.PlayingState
+	GameLog      = gamelogic.GameLog
+)
@@ -1,16 +1,51 @@
 package routing
 
+import "github.com/thrashdev/bootdev-peril/internal/pubsub"
+
 const (
-	ArmyMovesPrefix = "army_moves"
+	WorldEventsPrefix = "world_events"
 
-	WarRecognitionsPrefix = "war"
+	CommandsPrefix = "commands"
 
 	PauseKey = "pause"
 
+	TurnKey = "turn"
+
+	GameOverKey = "game_over"
+
 	GameLogSlug = "game_logs"
+
+	UnitsQueryPrefix = "units_query"
+
+	StatusQueryKey = "status_query"
+
+	DiplomacyPrefix = "diplomacy"
+
+	DeadLetterQueue = "peril_dlq"
 )
 
 const (
 	ExchangePerilDirect = "peril_direct"
 	ExchangePerilTopic  = "peril_topic"
+	ExchangePerilDLX    = "peril_dlx"
 )
+
+type Exchange struct {
+	Name string
+	Kind pubsub.ExchangeKind
+}
+
+var Exchanges = []Exchange{
+	{Name: ExchangePerilDirect, Kind: pubsub.ExchangeDirect},
+	{Name: ExchangePerilTopic, Kind: pubsub.ExchangeTopic},
+	{Name: ExchangePerilDLX, Kind: pubsub.ExchangeFanout},
+}
+
+func ExchangeKind(name string) (pubsub.ExchangeKind, bool) {
+	for _, ex := range Exchanges {
+		if ex.Name == name {
+			return ex.Kind, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,187 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/thrashdev/bootdev-peril/internal/pubsub"
+)
+
+// UsernamePlaceholder is replaced by a player's username in topic templates.
+const UsernamePlaceholder = "{username}"
+
+// Topic ties a payload type to where it is published and how it is
+// consumed. Key, Queue and Binding are templates that may contain
+// UsernamePlaceholder: Key is filled in with the player a message is about,
+// Queue and Binding with the subscribing player.
+type Topic[T any] struct {
+	Name      string
+	Exchange  string
+	Key       string
+	Queue     string
+	Binding   string
+	Codec     pubsub.Codec
+	QueueType pubsub.SimpleQueueType
+}
+
+func (t Topic[T]) RoutingKey(username string) string {
+	return expand(t.Key, username)
+}
+
+func (t Topic[T]) QueueName(username string) string {
+	return expand(t.Queue, username)
+}
+
+func (t Topic[T]) BindingKey(username string) string {
+	return expand(t.Binding, username)
+}
+
+// Publish publishes val with the routing key for username.
+func (t Topic[T]) Publish(pub pubsub.Publisher, username string, val T, opts ...pubsub.PublishOption) error {
+	return pubsub.Publish(pub, t.Codec, t.Exchange, t.RoutingKey(username), val, opts...)
+}
+
+// Subscribe consumes the topic as username.
+func (t Topic[T]) Subscribe(ctx context.Context, sub pubsub.Subscriber, username string, handler func(T) pubsub.Acktype, opts ...pubsub.SubscribeOption) (*pubsub.Subscription, error) {
+	return pubsub.Subscribe(ctx, sub, t.Exchange, t.QueueName(username), t.BindingKey(username), t.QueueType, t.Codec, handler, opts...)
+}
+
+func (t Topic[T]) SubscribeDelivery(ctx context.Context, sub pubsub.Subscriber, username string, handler func(pubsub.Delivery[T]) pubsub.Acktype, opts ...pubsub.SubscribeOption) (*pubsub.Subscription, error) {
+	return pubsub.SubscribeDelivery(ctx, sub, t.Exchange, t.QueueName(username), t.BindingKey(username), t.QueueType, t.Codec, handler, opts...)
+}
+
+func (t Topic[T]) info() TopicInfo {
+	return TopicInfo{
+		Name:      t.Name,
+		Exchange:  t.Exchange,
+		Key:       t.Key,
+		Queue:     t.Queue,
+		Binding:   t.Binding,
+		Codec:     t.Codec,
+		QueueType: t.QueueType,
+		Payload:   reflect.TypeFor[T](),
+	}
+}
+
+// Service is a topic whose messages are requests answered with Resp.
+type Service[Req, Resp any] struct {
+	Topic[Req]
+}
+
+func (s Service[Req, Resp]) Call(ctx context.Context, r pubsub.Requester, username string, req Req, opts ...pubsub.PublishOption) (Resp, error) {
+	return pubsub.Call[Req, Resp](ctx, r, s.Codec, s.Exchange, s.RoutingKey(username), req, opts...)
+}
+
+func (s Service[Req, Resp]) CallAll(ctx context.Context, r pubsub.Requester, username string, req Req, opts ...pubsub.PublishOption) ([]pubsub.Delivery[Resp], error) {
+	return pubsub.CallAll[Req, Resp](ctx, r, s.Codec, s.Exchange, s.RoutingKey(username), req, opts...)
+}
+
+func (s Service[Req, Resp]) Serve(ctx context.Context, broker pubsub.Broker, username string, handler func(context.Context, pubsub.Delivery[Req]) (Resp, error), opts ...pubsub.SubscribeOption) (*pubsub.Subscription, error) {
+	return pubsub.Serve(ctx, broker, s.Exchange, s.QueueName(username), s.BindingKey(username), s.QueueType, s.Codec, handler, opts...)
+}
+
+// TopicInfo describes a registered topic without its type parameter.
+type TopicInfo struct {
+	Name      string
+	Exchange  string
+	Key       string
+	Queue     string
+	Binding   string
+	Codec     pubsub.Codec
+	QueueType pubsub.SimpleQueueType
+	Payload   reflect.Type
+}
+
+// NewPayload returns a pointer to a zero payload, ready to decode into.
+func (i TopicInfo) NewPayload() any {
+	return reflect.New(i.Payload).Interface()
+}
+
+// Matches reports whether a message published to exchange with key belongs
+// to this topic.
+func (i TopicInfo) Matches(exchange, key string) bool {
+	kind, ok := ExchangeKind(exchange)
+	if !ok || exchange != i.Exchange {
+		return false
+	}
+	if kind == pubsub.ExchangeDirect {
+		kind = pubsub.ExchangeTopic
+	}
+	return pubsub.MatchRoutingKey(kind, expand(i.Key, "*"), key)
+}
+
+var registry = struct {
+	sync.Mutex
+	topics []TopicInfo
+}{}
+
+// Register validates t and adds it to the registry, panicking on a bad
+// definition so mistakes surface at startup.
+func Register[T any](t Topic[T]) Topic[T] {
+	if err := validate(t.info()); err != nil {
+		panic(err)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, other := range registry.topics {
+		if other.Name == t.Name {
+			panic(fmt.Sprintf("routing: topic %s registered twice", t.Name))
+		}
+	}
+	registry.topics = append(registry.topics, t.info())
+	return t
+}
+
+func RegisterService[Req, Resp any](s Service[Req, Resp]) Service[Req, Resp] {
+	Register(s.Topic)
+	return s
+}
+
+// Topics returns every registered topic in registration order.
+func Topics() []TopicInfo {
+	registry.Lock()
+	defer registry.Unlock()
+	return append([]TopicInfo(nil), registry.topics...)
+}
+
+// LookupTopic finds the topic a message published to exchange with key
+// belongs to.
+func LookupTopic(exchange, key string) (TopicInfo, bool) {
+	for _, t := range Topics() {
+		if t.Matches(exchange, key) {
+			return t, true
+		}
+	}
+	return TopicInfo{}, false
+}
+
+func validate(t TopicInfo) error {
+	if t.Name == "" {
+		return fmt.Errorf("routing: topic without a name")
+	}
+	kind, ok := ExchangeKind(t.Exchange)
+	if !ok {
+		return fmt.Errorf("routing: topic %s uses unknown exchange %s", t.Name, t.Exchange)
+	}
+	if t.Codec == nil {
+		return fmt.Errorf("routing: topic %s has no codec", t.Name)
+	}
+	for _, tmpl := range []string{t.Key, t.Queue, t.Binding} {
+		rest := strings.ReplaceAll(tmpl, UsernamePlaceholder, "")
+		if tmpl == "" || strings.ContainsAny(rest, "{}") {
+			return fmt.Errorf("routing: topic %s has a bad template %q", t.Name, tmpl)
+		}
+	}
+	// A player's own messages must reach the queue they subscribe with.
+	if !pubsub.MatchRoutingKey(kind, expand(t.Binding, "player"), expand(t.Key, "player")) {
+		return fmt.Errorf("routing: topic %s binding %s does not match key %s", t.Name, t.Binding, t.Key)
+	}
+	return nil
+}
+
+func expand(tmpl, username string) string {
+	return strings.ReplaceAll(tmpl, UsernamePlaceholder, username)
+}
@@ -0,0 +1,127 @@
+package routing
+
+import (
+	"github.com/thrashdev/bootdev-peril/internal/gamelogic"
+	"github.com/thrashdev/bootdev-peril/internal/pubsub"
+)
+
+var (
+	// WorldEvents carries the server's authoritative changes to every
+	// player.
+	WorldEvents = Register(Topic[gamelogic.Event]{
+		Name:      "world_events",
+		Exchange:  ExchangePerilTopic,
+		Key:       WorldEventsPrefix + "." + UsernamePlaceholder,
+		Queue:     WorldEventsPrefix + "." + UsernamePlaceholder,
+		Binding:   WorldEventsPrefix + ".*",
+		Codec:     pubsub.JSON,
+		QueueType: pubsub.SimpleQueueTransient,
+	})
+
+	// Join, Spawn, Move and Ready are commands the server validates and
+	// applies.
+	Join = RegisterService(Service[gamelogic.JoinCommand, gamelogic.JoinResult]{command[gamelogic.JoinCommand]("join")})
+
+	Spawn = RegisterService(Service[gamelogic.SpawnCommand, gamelogic.CommandResult]{command[gamelogic.SpawnCommand]("spawn")})
+
+	Move = RegisterService(Service[gamelogic.MoveCommand, gamelogic.CommandResult]{command[gamelogic.MoveCommand]("move")})
+
+	// Ready ends the player's turn early in turn-based games.
+	Ready = RegisterService(Service[gamelogic.ReadyCommand, gamelogic.CommandResult]{command[gamelogic.ReadyCommand]("ready")})
+
+	// Resources asks the server for a player's balance and income.
+	Resources = RegisterService(Service[gamelogic.ResourcesQuery, gamelogic.ResourcesReport]{command[gamelogic.ResourcesQuery]("resources")})
+
+	// Diplomacy proposes, accepts or breaks a pact with another player.
+	Diplomacy = RegisterService(Service[gamelogic.Diplomacy, gamelogic.CommandResult]{command[gamelogic.Diplomacy]("diplomacy")})
+
+	// DiplomacyMessages carries the pacts the server has accepted to both
+	// players involved.
+	DiplomacyMessages = Register(Topic[gamelogic.Diplomacy]{
+		Name:      "diplomacy",
+		Exchange:  ExchangePerilDirect,
+		Key:       DiplomacyPrefix + "." + UsernamePlaceholder,
+		Queue:     DiplomacyPrefix + "." + UsernamePlaceholder,
+		Binding:   DiplomacyPrefix + "." + UsernamePlaceholder,
+		Codec:     pubsub.JSON,
+		QueueType: pubsub.SimpleQueueTransient,
+	})
+
+	Pause = Register(Topic[PlayingState]{
+		Name:      "pause",
+		Exchange:  ExchangePerilDirect,
+		Key:       PauseKey,
+		Queue:     PauseKey + "." + UsernamePlaceholder,
+		Binding:   PauseKey,
+		Codec:     pubsub.JSON,
+		QueueType: pubsub.SimpleQueueTransient,
+	})
+
+	// Turns carries the server's turn clock in turn-based games.
+	Turns = Register(Topic[gamelogic.TurnState]{
+		Name:      "turns",
+		Exchange:  ExchangePerilDirect,
+		Key:       TurnKey,
+		Queue:     TurnKey + "." + UsernamePlaceholder,
+		Binding:   TurnKey,
+		Codec:     pubsub.JSON,
+		QueueType: pubsub.SimpleQueueTransient,
+	})
+
+	// GameOver announces the end of the game.
+	GameOver = Register(Topic[gamelogic.GameOver]{
+		Name:      "game_over",
+		Exchange:  ExchangePerilDirect,
+		Key:       GameOverKey,
+		Queue:     GameOverKey + "." + UsernamePlaceholder,
+		Binding:   GameOverKey,
+		Codec:     pubsub.JSON,
+		QueueType: pubsub.SimpleQueueTransient,
+	})
+
+	GameLogs = Register(Topic[GameLog]{
+		Name:      "game_logs",
+		Exchange:  ExchangePerilTopic,
+		Key:       GameLogSlug + "." + UsernamePlaceholder,
+		Queue:     GameLogSlug,
+		Binding:   GameLogSlug + ".*",
+		Codec:     pubsub.Gob,
+		QueueType: pubsub.SimpleQueueDurable,
+	})
+
+	// UnitsQuery asks one player about their units.
+	UnitsQuery = RegisterService(Service[gamelogic.UnitsQuery, gamelogic.UnitsReport]{Topic[gamelogic.UnitsQuery]{
+		Name:      "units_query",
+		Exchange:  ExchangePerilDirect,
+		Key:       UnitsQueryPrefix + "." + UsernamePlaceholder,
+		Queue:     UnitsQueryPrefix + "." + UsernamePlaceholder,
+		Binding:   UnitsQueryPrefix + "." + UsernamePlaceholder,
+		Codec:     pubsub.JSON,
+		QueueType: pubsub.SimpleQueueTransient,
+	}})
+
+	// StatusQuery is answered by every connected player.
+	StatusQuery = RegisterService(Service[gamelogic.StatusQuery, gamelogic.StatusReport]{Topic[gamelogic.StatusQuery]{
+		Name:      "status_query",
+		Exchange:  ExchangePerilDirect,
+		Key:       StatusQueryKey,
+		Queue:     StatusQueryKey + "." + UsernamePlaceholder,
+		Binding:   StatusQueryKey,
+		Codec:     pubsub.JSON,
+		QueueType: pubsub.SimpleQueueTransient,
+	}})
+)
+
+// command is the topic of a command served by the one running server.
+func command[T any](name string) Topic[T] {
+	key := CommandsPrefix + "." + name
+	return Topic[T]{
+		Name:      key,
+		Exchange:  ExchangePerilDirect,
+		Key:       key,
+		Queue:     key,
+		Binding:   key,
+		Codec:     pubsub.JSON,
+		QueueType: pubsub.SimpleQueueTransient,
+	}
+}
@@ -0,0 +1,206 @@
+// Package topology describes the exchanges and queues Peril expects a
+// broker to have, and can declare or verify them.
+package topology
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/thrashdev/bootdev-peril/internal/pubsub"
+	"github.com/thrashdev/bootdev-peril/internal/routing"
+)
+
+type Exchange struct {
+	Name string              `json:"name"`
+	Kind pubsub.ExchangeKind `json:"kind"`
+}
+
+type Binding struct {
+	Exchange string `json:"exchange"`
+	Key      string `json:"key"`
+}
+
+// Queue is declared bound to each of its bindings. Queues are dead-lettered
+// to pubsub.DeadLetterExchange unless bound to it themselves.
+type Queue struct {
+	Name     string    `json:"name"`
+	Durable  bool      `json:"durable"`
+	Bindings []Binding `json:"bindings"`
+}
+
+func (q Queue) queueType() pubsub.SimpleQueueType {
+	if q.Durable {
+		return pubsub.SimpleQueueDurable
+	}
+	return pubsub.SimpleQueueTransient
+}
+
+type Topology struct {
+	Exchanges []Exchange `json:"exchanges"`
+	Queues    []Queue    `json:"queues"`
+}
+
+// Default is derived from the routing package: every exchange, the durable
+// queues of topics that all players share, and the dead-letter queue.
+// Transient queues are left to whoever consumes them.
+func Default() Topology {
+	t := Topology{}
+	for _, ex := range routing.Exchanges {
+		t.Exchanges = append(t.Exchanges, Exchange{Name: ex.Name, Kind: ex.Kind})
+	}
+	for _, topic := range routing.Topics() {
+		if strings.Contains(topic.Queue, routing.UsernamePlaceholder) || topic.QueueType != pubsub.SimpleQueueDurable {
+			continue
+		}
+		t.Queues = append(t.Queues, Queue{
+			Name:     topic.Queue,
+			Durable:  topic.QueueType == pubsub.SimpleQueueDurable,
+			Bindings: []Binding{{Exchange: topic.Exchange, Key: topic.Binding}},
+		})
+	}
+	t.Queues = append(t.Queues, Queue{
+		Name:     routing.DeadLetterQueue,
+		Durable:  true,
+		Bindings: []Binding{{Exchange: routing.ExchangePerilDLX, Key: "#"}},
+	})
+	return t
+}
+
+// Load reads a topology from a JSON file laid out like Topology.
+func Load(path string) (Topology, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Topology{}, fmt.Errorf("could not open topology: %v", err)
+	}
+	defer f.Close()
+
+	t := Topology{}
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return Topology{}, fmt.Errorf("could not read topology %s: %v", path, err)
+	}
+	if err := t.Validate(); err != nil {
+		return Topology{}, fmt.Errorf("invalid topology %s: %v", path, err)
+	}
+	return t, nil
+}
+
+func (t Topology) Validate() error {
+	exchanges := map[string]bool{}
+	for _, ex := range t.Exchanges {
+		switch ex.Kind {
+		case pubsub.ExchangeDirect, pubsub.ExchangeTopic, pubsub.ExchangeFanout:
+		default:
+			return fmt.Errorf("exchange %s has unknown kind %q", ex.Name, ex.Kind)
+		}
+		if ex.Name == "" || exchanges[ex.Name] {
+			return fmt.Errorf("exchange name %q is empty or repeated", ex.Name)
+		}
+		exchanges[ex.Name] = true
+	}
+
+	queues := map[string]bool{}
+	for _, q := range t.Queues {
+		if q.Name == "" || queues[q.Name] {
+			return fmt.Errorf("queue name %q is empty or repeated", q.Name)
+		}
+		queues[q.Name] = true
+		if len(q.Bindings) == 0 {
+			return fmt.Errorf("queue %s has no bindings", q.Name)
+		}
+		for _, bnd := range q.Bindings {
+			if !exchanges[bnd.Exchange] {
+				return fmt.Errorf("queue %s is bound to undeclared exchange %s", q.Name, bnd.Exchange)
+			}
+		}
+	}
+	return nil
+}
+
+func DeclareExchanges(broker pubsub.Broker, t Topology) error {
+	for _, ex := range t.Exchanges {
+		if err := broker.DeclareExchange(ex.Name, ex.Kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply declares every exchange, queue and binding in t. Declaring is
+// idempotent, so it is safe to run against a broker that is already set up.
+func Apply(broker pubsub.Broker, t Topology) error {
+	if err := DeclareExchanges(broker, t); err != nil {
+		return err
+	}
+	for _, q := range t.Queues {
+		for _, bnd := range q.Bindings {
+			if err := broker.DeclareQueue(bnd.Exchange, q.Name, bnd.Key, q.queueType()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Drift is a difference between the broker and the expected topology.
+type Drift struct {
+	Object  string
+	Problem string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: %s", d.Object, d.Problem)
+}
+
+type Report struct {
+	Drift []Drift
+	// Unchecked counts what the broker gave no way of checking.
+	Unchecked int
+}
+
+// Verify compares the broker against t without changing it.
+func Verify(broker pubsub.Broker, t Topology) (Report, error) {
+	inspector, ok := broker.(pubsub.Inspector)
+	if !ok {
+		return Report{}, errors.New("broker can not be inspected")
+	}
+
+	r := Report{}
+	check := func(object string, err error) error {
+		switch {
+		case err == nil:
+		case errors.Is(err, errors.ErrUnsupported):
+			r.Unchecked++
+		case errors.Is(err, pubsub.ErrNotDeclared), errors.Is(err, pubsub.ErrMismatch):
+			r.Drift = append(r.Drift, Drift{Object: object, Problem: err.Error()})
+		default:
+			return fmt.Errorf("could not check %s: %w", object, err)
+		}
+		return nil
+	}
+
+	for _, ex := range t.Exchanges {
+		err := inspector.InspectExchange(ex.Name, ex.Kind)
+		if err := check(fmt.Sprintf("exchange %s", ex.Name), err); err != nil {
+			return r, err
+		}
+	}
+	for _, q := range t.Queues {
+		err := inspector.InspectQueue(q.Bindings[0].Exchange, q.Name, q.queueType())
+		if err := check(fmt.Sprintf("queue %s", q.Name), err); err != nil {
+			return r, err
+		}
+		for _, bnd := range q.Bindings {
+			err := inspector.InspectBinding(bnd.Exchange, q.Name, bnd.Key)
+			object := fmt.Sprintf("binding %s -> %s (%s)", bnd.Exchange, q.Name, bnd.Key)
+			if err := check(object, err); err != nil {
+				return r, err
+			}
+		}
+	}
+	return r, nil
+}
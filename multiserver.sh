@@ -1,5 +1,9 @@
 #!/bin/bash
 
+# Runs extra servers that only write game logs, to help the server running
+# the game keep up. Start that one first, on its own: only one server can run
+# the game.
+
 # Check if the number of instances was provided
 if [ -z "$1" ]; then
   echo "Usage: $0 <number-of-instances>"
@@ -23,9 +27,11 @@ cleanup() {
 # Setup trap for SIGINT
 trap 'cleanup' SIGINT
 
-# Start the specified number of instances of the program in the background
+# Start the specified number of log writers in the background. Each remembers
+# the logs it wrote in a file of its own, so a log redelivered to a different
+# instance can be written twice.
 for (( i=0; i<num_instances; i++ )); do
-  go run ./cmd/server &
+  go run ./cmd/server -logs-only -log-dedup-file "game.log.dedup.$i" &
   pids+=($!)
 done
 